@@ -0,0 +1,521 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alpsilva/go-blog-aggregator.git/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultServeAddr   = ":8080"
+	defaultPostsLimit  = 20
+	maxPostsLimit      = 100
+	apiKeyHeaderPrefix = "ApiKey "
+)
+
+type apiServer struct {
+	db     *database.Queries
+	webSub *webSubSubscriber
+	// baseURL is the public address of the server, used to link to the
+	// documents it publishes. Request headers can't be trusted for that.
+	baseURL string
+}
+
+type authedHandler func(http.ResponseWriter, *http.Request, database.User)
+
+type apiUser struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Name      string    `json:"name"`
+	ApiKey    string    `json:"api_key"`
+}
+
+type apiFeed struct {
+	ID            uuid.UUID  `json:"id"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	UserID        uuid.UUID  `json:"user_id"`
+	Name          string     `json:"name"`
+	Url           string     `json:"url"`
+	LastFetchedAt *time.Time `json:"last_fetched_at"`
+	Disabled      bool       `json:"disabled"`
+}
+
+type apiFeedFollow struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	UserID    uuid.UUID `json:"user_id"`
+	FeedID    uuid.UUID `json:"feed_id"`
+	FeedName  string    `json:"feed_name"`
+}
+
+type apiPost struct {
+	ID          uuid.UUID `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	Title       string    `json:"title"`
+	Url         string    `json:"url"`
+	Description *string   `json:"description"`
+	PublishedAt time.Time `json:"published_at"`
+	FeedID      uuid.UUID `json:"feed_id"`
+	FeedName    string    `json:"feed_name"`
+}
+
+func nullTimePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+func nullStringPtr(s sql.NullString) *string {
+	if !s.Valid {
+		return nil
+	}
+	return &s.String
+}
+
+func userToAPI(user database.User) apiUser {
+	return apiUser{
+		ID:        user.ID,
+		CreatedAt: user.CreatedAt,
+		UpdatedAt: user.UpdatedAt,
+		Name:      user.Name,
+		ApiKey:    user.ApiKey,
+	}
+}
+
+func feedToAPI(feed database.Feed) apiFeed {
+	return apiFeed{
+		ID:            feed.ID,
+		CreatedAt:     feed.CreatedAt,
+		UpdatedAt:     feed.UpdatedAt,
+		UserID:        feed.UserID,
+		Name:          feed.Name,
+		Url:           feed.Url,
+		LastFetchedAt: nullTimePtr(feed.LastFetchedAt),
+		Disabled:      feed.Disabled,
+	}
+}
+
+func postToAPI(post database.GetTimelineForUserRow) apiPost {
+	return apiPost{
+		ID:          post.ID,
+		CreatedAt:   post.CreatedAt,
+		UpdatedAt:   post.UpdatedAt,
+		Title:       post.Title,
+		Url:         post.Url,
+		Description: nullStringPtr(post.Description),
+		PublishedAt: post.PublishedAt,
+		FeedID:      post.FeedID,
+		FeedName:    post.FeedName,
+	}
+}
+
+func respondWithJSON(w http.ResponseWriter, code int, payload any) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		fmt.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(data)
+}
+
+func respondWithError(w http.ResponseWriter, code int, msg string) {
+	if code >= 500 {
+		fmt.Println(msg)
+	}
+
+	respondWithJSON(w, code, map[string]string{"error": msg})
+}
+
+// respondWithDBError maps the database errors handlers commonly run into
+// onto HTTP status codes.
+func respondWithDBError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		respondWithError(w, http.StatusNotFound, "not found")
+	case isUniqueViolation(err):
+		respondWithError(w, http.StatusConflict, "already exists")
+	default:
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// validateBaseURL makes sure the URLs built from the base url passed with
+// flag name are reachable from outside.
+func validateBaseURL(name string, baseURL string) error {
+	parsed, err := url.Parse(baseURL)
+	if err != nil {
+		return err
+	}
+	if parsed.Scheme == "" || parsed.Host == "" {
+		return fmt.Errorf("--%s must be an absolute url", name)
+	}
+	return nil
+}
+
+func decodeJSONBody(r *http.Request, v any) error {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
+
+// middlewareAPIKey is the HTTP counterpart of middlewareLoggedIn. It reads
+// the "Authorization: ApiKey <key>" header and passes the matching user on.
+func (a *apiServer) middlewareAPIKey(handler authedHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		apiKey, ok := strings.CutPrefix(header, apiKeyHeaderPrefix)
+		if !ok || apiKey == "" {
+			respondWithError(w, http.StatusUnauthorized, "missing api key")
+			return
+		}
+
+		user, err := a.db.GetUserByAPIKey(r.Context(), apiKey)
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusUnauthorized, "invalid api key")
+			return
+		}
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		handler(w, r, user)
+	}
+}
+
+// newToken returns a random 256-bit token, hex encoded, for API keys and
+// feed tokens.
+func newToken() (string, error) {
+	token := make([]byte, 32)
+	_, err := rand.Read(token)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(token), nil
+}
+
+func (a *apiServer) handlerCreateUser(w http.ResponseWriter, r *http.Request) {
+	body := struct {
+		Name string `json:"name"`
+	}{}
+	err := decodeJSONBody(r, &body)
+	if err != nil || body.Name == "" {
+		respondWithError(w, http.StatusBadRequest, "body needs a name")
+		return
+	}
+
+	apiKey, err := newToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	feedToken, err := newToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	user, err := a.db.CreateUser(r.Context(), database.CreateUserParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		Name:      body.Name,
+		ApiKey:    apiKey,
+		FeedToken: feedToken,
+	})
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, userToAPI(user))
+}
+
+func (a *apiServer) handlerGetUser(w http.ResponseWriter, r *http.Request, user database.User) {
+	respondWithJSON(w, http.StatusOK, userToAPI(user))
+}
+
+func (a *apiServer) handlerListFeeds(w http.ResponseWriter, r *http.Request, user database.User) {
+	feeds, err := a.db.GetFeeds(r.Context())
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+
+	response := []apiFeed{}
+	for _, feed := range feeds {
+		response = append(response, feedToAPI(feed))
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (a *apiServer) handlerCreateFeed(w http.ResponseWriter, r *http.Request, user database.User) {
+	body := struct {
+		Name string `json:"name"`
+		Url  string `json:"url"`
+	}{}
+	err := decodeJSONBody(r, &body)
+	if err != nil || body.Url == "" {
+		respondWithError(w, http.StatusBadRequest, "body needs an url")
+		return
+	}
+
+	// Same checks as addfeed, minus --force.
+	feedURL, rssFeed, err := validateFeedURL(r.Context(), body.Url)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("%s is not a valid feed: %s", body.Url, err))
+		return
+	}
+
+	feed, err := addFetchedFeed(r.Context(), a.db, user, body.Name, feedURL, rssFeed)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, feedToAPI(feed))
+}
+
+func (a *apiServer) handlerListFollows(w http.ResponseWriter, r *http.Request, user database.User) {
+	follows, err := a.db.GetFeedFollowsForUser(r.Context(), user.ID)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+
+	response := []apiFeed{}
+	for _, follow := range follows {
+		response = append(response, apiFeed{
+			ID:            follow.ID,
+			CreatedAt:     follow.CreatedAt,
+			UpdatedAt:     follow.UpdatedAt,
+			UserID:        follow.UserID,
+			Name:          follow.Name,
+			Url:           follow.Url,
+			LastFetchedAt: nullTimePtr(follow.LastFetchedAt),
+			Disabled:      follow.Disabled,
+		})
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (a *apiServer) handlerCreateFollow(w http.ResponseWriter, r *http.Request, user database.User) {
+	body := struct {
+		FeedUrl string `json:"feed_url"`
+	}{}
+	err := decodeJSONBody(r, &body)
+	if err != nil || body.FeedUrl == "" {
+		respondWithError(w, http.StatusBadRequest, "body needs a feed_url")
+		return
+	}
+
+	feed, err := a.db.GetFeedByUrl(r.Context(), body.FeedUrl)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "feed not found, add it first with POST /v1/feeds")
+		return
+	}
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+
+	follow, err := followFeed(r.Context(), a.db, user, feed.ID)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, apiFeedFollow{
+		ID:        follow.ID,
+		CreatedAt: follow.CreatedAt,
+		UpdatedAt: follow.UpdatedAt,
+		UserID:    follow.UserID,
+		FeedID:    follow.FeedID,
+		FeedName:  follow.FeedName,
+	})
+}
+
+func (a *apiServer) handlerDeleteFollow(w http.ResponseWriter, r *http.Request, user database.User) {
+	feedID, err := uuid.Parse(r.PathValue("feedID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid feed id")
+		return
+	}
+
+	err = a.db.DeleteFeedFollow(r.Context(), database.DeleteFeedFollowParams{
+		UserID: user.ID,
+		FeedID: feedID,
+	})
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// queryInt reads a non-negative integer query parameter.
+func queryInt(r *http.Request, name string, fallback int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return fallback, nil
+	}
+
+	number, err := strconv.Atoi(value)
+	if err != nil || number < 1 {
+		return 0, fmt.Errorf("%s must be a positive number", name)
+	}
+
+	return number, nil
+}
+
+func (a *apiServer) handlerListPosts(w http.ResponseWriter, r *http.Request, user database.User) {
+	limit, err := queryInt(r, "limit", defaultPostsLimit)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	limit = min(limit, maxPostsLimit)
+
+	query := r.URL.Query()
+	params := database.GetTimelineForUserParams{
+		UserID:     user.ID,
+		FeedUrl:    sql.NullString{String: query.Get("feed"), Valid: query.Get("feed") != ""},
+		Tag:        sql.NullString{String: query.Get("tag"), Valid: query.Get("tag") != ""},
+		PostTag:    sql.NullString{String: query.Get("post_tag"), Valid: query.Get("post_tag") != ""},
+		UnreadOnly: query.Get("unread") == "true",
+		MaxPosts:   int32(limit),
+	}
+
+	params.Since, err = parseDateFlag(query.Get("since"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "since must be a YYYY-MM-DD date")
+		return
+	}
+	params.Until, err = parseDateFlag(query.Get("until"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "until must be a YYYY-MM-DD date")
+		return
+	}
+
+	if query.Has("after") {
+		after, err := uuid.Parse(query.Get("after"))
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "after must be a post id")
+			return
+		}
+		params.After = uuid.NullUUID{UUID: after, Valid: true}
+	}
+
+	posts, err := a.db.GetTimelineForUser(r.Context(), params)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+
+	response := []apiPost{}
+	for _, post := range posts {
+		response = append(response, postToAPI(post))
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (a *apiServer) routes() *http.ServeMux {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("POST /v1/users", a.handlerCreateUser)
+	mux.HandleFunc("GET /v1/users/me", a.middlewareAPIKey(a.handlerGetUser))
+
+	mux.HandleFunc("GET /v1/feeds", a.middlewareAPIKey(a.handlerListFeeds))
+	mux.HandleFunc("POST /v1/feeds", a.middlewareAPIKey(a.handlerCreateFeed))
+
+	mux.HandleFunc("GET /v1/feed_follows", a.middlewareAPIKey(a.handlerListFollows))
+	mux.HandleFunc("POST /v1/feed_follows", a.middlewareAPIKey(a.handlerCreateFollow))
+	mux.HandleFunc("DELETE /v1/feed_follows/{feedID}", a.middlewareAPIKey(a.handlerDeleteFollow))
+
+	mux.HandleFunc("GET /v1/posts", a.middlewareAPIKey(a.handlerListPosts))
+
+	mux.HandleFunc("GET /feeds/{token}", a.handlerOutputFeed)
+
+	if a.webSub != nil {
+		mux.HandleFunc("GET /websub/{id}", a.webSub.handlerVerify)
+		mux.HandleFunc("POST /websub/{id}", a.webSub.handlerContent)
+	}
+
+	return mux
+}
+
+func handlerServe(s *state, cmd command) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	callbackBase := fs.String("websub-callback", "", "public base url of this server, enables WebSub subscriptions")
+	baseURL := fs.String("base-url", "", "public base url of this server, used in published feeds (defaults to --websub-callback)")
+	args, err := parseArgs(fs, cmd.args)
+	if err != nil {
+		return err
+	}
+
+	addr := defaultServeAddr
+	if len(args) > 0 {
+		addr = args[0]
+	}
+
+	api := apiServer{db: s.db, baseURL: *baseURL}
+	if api.baseURL == "" {
+		api.baseURL = *callbackBase
+	}
+	if *baseURL != "" {
+		err = validateBaseURL("base-url", *baseURL)
+		if err != nil {
+			return err
+		}
+	}
+
+	if *callbackBase != "" {
+		err = validateBaseURL("websub-callback", *callbackBase)
+		if err != nil {
+			return err
+		}
+
+		api.webSub = &webSubSubscriber{
+			db:           s.db,
+			callbackBase: *callbackBase,
+			client:       &http.Client{Timeout: 30 * time.Second},
+		}
+		go api.webSub.renewLoop(context.Background())
+	}
+
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           api.routes(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	fmt.Printf("Serving gator API on %s\n", addr)
+
+	return server.ListenAndServe()
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alpsilva/go-blog-aggregator.git/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestQueryInt(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    int
+		wantErr bool
+	}{
+		{"", 20, false},
+		{"limit=5", 5, false},
+		{"limit=0", 0, true},
+		{"limit=-1", 0, true},
+		{"limit=many", 0, true},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/v1/posts?"+test.query, nil)
+		got, err := queryInt(r, "limit", 20)
+		if (err != nil) != test.wantErr || got != test.want {
+			t.Errorf("queryInt(%q) = %d, %v", test.query, got, err)
+		}
+	}
+}
+
+func TestCreateFeedValidatesURL(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<!doctype html><title>No feed here</title><p>Hello</p>"))
+	}))
+	defer site.Close()
+
+	fake, db := newFakeDB(t)
+	api := apiServer{db: db}
+
+	body := strings.NewReader(`{"name": "Site", "url": "` + site.URL + `"}`)
+	w := httptest.NewRecorder()
+	api.handlerCreateFeed(w, httptest.NewRequest("POST", "/v1/feeds", body), database.User{ID: uuid.New()})
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("creating a feed without one answered %d: %s", w.Code, w.Body)
+	}
+	if len(fake.called("CreateFeed")) != 0 {
+		t.Fatal("a url without a feed was added")
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/xml"
+	"strings"
+)
+
+type AtomFeed struct {
+	XMLName  xml.Name    `xml:"feed"`
+	Lang     string      `xml:"http://www.w3.org/XML/1998/namespace lang,attr"`
+	Title    string      `xml:"title"`
+	Subtitle string      `xml:"subtitle"`
+	Icon     string      `xml:"icon"`
+	Logo     string      `xml:"logo"`
+	Links    []AtomLink  `xml:"link"`
+	Entries  []AtomEntry `xml:"entry"`
+}
+
+type AtomLink struct {
+	Href   string `xml:"href,attr"`
+	Rel    string `xml:"rel,attr"`
+	Type   string `xml:"type,attr"`
+	Length string `xml:"length,attr"`
+}
+
+type AtomText struct {
+	Type  string `xml:"type,attr"`
+	Text  string `xml:",chardata"`
+	Inner string `xml:",innerxml"`
+}
+
+type AtomPerson struct {
+	Name string `xml:"name"`
+}
+
+type AtomCategory struct {
+	Term  string `xml:"term,attr"`
+	Label string `xml:"label,attr"`
+}
+
+type AtomEntry struct {
+	ID         string         `xml:"id"`
+	Title      string         `xml:"title"`
+	Links      []AtomLink     `xml:"link"`
+	Updated    string         `xml:"updated"`
+	Published  string         `xml:"published"`
+	Summary    AtomText       `xml:"summary"`
+	Content    AtomText       `xml:"content"`
+	Authors    []AtomPerson   `xml:"author"`
+	Categories []AtomCategory `xml:"category"`
+}
+
+// String returns the text of an Atom text construct. xhtml content is kept
+// as markup, the other types are already unescaped by the decoder.
+func (t AtomText) String() string {
+	if t.Type == "xhtml" {
+		return t.Inner
+	}
+	return t.Text
+}
+
+func (e AtomEntry) authorNames() string {
+	names := []string{}
+	for _, author := range e.Authors {
+		if author.Name != "" {
+			names = append(names, author.Name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+func (e AtomEntry) categoryNames() []string {
+	names := []string{}
+	for _, category := range e.Categories {
+		if category.Label != "" {
+			names = append(names, category.Label)
+		} else if category.Term != "" {
+			names = append(names, category.Term)
+		}
+	}
+	return names
+}
+
+// enclosures returns the files attached to the entry with
+// <link rel="enclosure">.
+func (e AtomEntry) enclosures() []RSSEnclosure {
+	enclosures := []RSSEnclosure{}
+	for _, link := range e.Links {
+		if link.Rel == "enclosure" {
+			enclosures = append(enclosures, RSSEnclosure{URL: link.Href, Type: link.Type, Length: link.Length})
+		}
+	}
+	return enclosures
+}
+
+// commentsLink returns the page with the comments on the entry, which
+// RFC 4685 links with rel="replies".
+func (e AtomEntry) commentsLink() string {
+	for _, link := range e.Links {
+		if link.Rel == "replies" && (link.Type == "" || link.Type == "text/html") {
+			return link.Href
+		}
+	}
+	return ""
+}
+
+// alternateLink picks the link that points at the human readable page,
+// which is rel="alternate" or a link without rel at all.
+func alternateLink(links []AtomLink) string {
+	for _, link := range links {
+		if link.Rel == "" || link.Rel == "alternate" {
+			return link.Href
+		}
+	}
+	if len(links) > 0 {
+		return links[0].Href
+	}
+	return ""
+}
+
+// toRSS maps the Atom document onto RSSFeed so that scrapeFeeds can handle
+// both formats with the same post creation code.
+func (a AtomFeed) toRSS() *RSSFeed {
+	rssFeed := RSSFeed{}
+	rssFeed.Channel.Title = a.Title
+	rssFeed.Channel.Link = alternateLink(a.Links)
+	rssFeed.Channel.Description = a.Subtitle
+	rssFeed.Channel.AtomLinks = a.Links
+	rssFeed.Channel.Language = a.Lang
+	rssFeed.Channel.ImageURL = a.Logo
+	if rssFeed.Channel.ImageURL == "" {
+		rssFeed.Channel.ImageURL = a.Icon
+	}
+
+	for _, entry := range a.Entries {
+		content := entry.Content.String()
+		description := entry.Summary.String()
+		if description == "" {
+			description = content
+		}
+
+		date := entry.Published
+		if date == "" {
+			date = entry.Updated
+		}
+
+		rssFeed.Channel.Item = append(rssFeed.Channel.Item, RSSItem{
+			Title:       entry.Title,
+			Link:        alternateLink(entry.Links),
+			Description: description,
+			PubDate:     date,
+			GUID:        entry.ID,
+			Content:     content,
+			Author:      entry.authorNames(),
+			Categories:  entry.categoryNames(),
+			Comments:    entry.commentsLink(),
+			Enclosures:  entry.enclosures(),
+		})
+	}
+
+	return &rssFeed
+}
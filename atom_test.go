@@ -0,0 +1,68 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAtomToRSS(t *testing.T) {
+	feed, err := parseFeed("application/atom+xml", []byte(readFixture(t, "atom.xml")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	channel := feed.Channel
+	if channel.Title != "Atom Example" || channel.Description != "Examples of every mapping" || channel.Language != "en" {
+		t.Errorf("unexpected channel %q, %q, %q", channel.Title, channel.Description, channel.Language)
+	}
+	// The self link comes first, but the channel link is the web page.
+	if channel.Link != "https://example.com/" {
+		t.Errorf("channel link is %q", channel.Link)
+	}
+	if channel.ImageURL != "https://example.com/icon.png" {
+		t.Errorf("channel image is %q", channel.ImageURL)
+	}
+
+	want := []RSSItem{
+		{
+			Title:       "HTML entry",
+			Link:        "https://example.com/html",
+			Description: "<p>Fish &amp; chips</p>",
+			PubDate:     "2024-03-01T10:00:00Z",
+			GUID:        "tag:example.com,2024:html",
+			Author:      "Jane, John",
+			Categories:  []string{"Food", "recipes"},
+			Comments:    "https://example.com/html#comments",
+			Enclosures:  []RSSEnclosure{{URL: "https://example.com/html.mp3", Type: "audio/mpeg", Length: "1234"}},
+		},
+		{
+			Title:       "XHTML entry",
+			Link:        "https://example.com/xhtml",
+			Description: `<div xmlns="http://www.w3.org/1999/xhtml"><p>Hello <b>world</b></p></div>`,
+			Content:     `<div xmlns="http://www.w3.org/1999/xhtml"><p>Hello <b>world</b></p></div>`,
+			PubDate:     "2024-03-02T10:00:00Z",
+			GUID:        "tag:example.com,2024:xhtml",
+			Categories:  []string{},
+			Enclosures:  []RSSEnclosure{},
+		},
+		{
+			Title:       "Only a related link",
+			Link:        "https://example.com/related",
+			Description: "Plain <text>",
+			Content:     "Plain <text>",
+			PubDate:     "2024-03-03T10:00:00Z",
+			GUID:        "tag:example.com,2024:related",
+			Categories:  []string{},
+			Enclosures:  []RSSEnclosure{},
+		},
+	}
+
+	if len(channel.Item) != len(want) {
+		t.Fatalf("expected %d items, got %d", len(want), len(channel.Item))
+	}
+	for i := range want {
+		if !reflect.DeepEqual(channel.Item[i], want[i]) {
+			t.Errorf("item %d:\n got %#v\nwant %#v", i, channel.Item[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// pubDateLayouts are the date formats seen in real feeds, most common first.
+// Zone abbreviations are rewritten to numeric offsets before parsing, see
+// normalizeZone, so every layout with a MST zone has a -0700 variant.
+var pubDateLayouts = []string{
+	time.RFC1123Z,
+	time.RFC1123,
+	time.RFC3339,
+	time.RFC3339Nano,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"Mon, 2 Jan 2006 15:04 -0700",
+	"Mon, 2 Jan 06 15:04:05 -0700",
+	"Mon, 2 Jan 06 15:04 -0700",
+	"Mon, 2 January 2006 15:04:05 -0700",
+	"2 Jan 2006 15:04:05 -0700",
+	"2 Jan 06 15:04:05 -0700",
+	"2 Jan 06 15:04 -0700",
+	time.RFC822Z,
+	time.RFC822,
+	"Monday, 02-Jan-06 15:04:05 -0700",
+	time.RFC850,
+	time.ANSIC,
+	"Mon Jan _2 15:04:05 -0700 2006",
+	time.UnixDate,
+	"2006-01-02T15:04:05-07:00",
+	"2006-01-02T15:04:05-0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	"January 2, 2006",
+}
+
+// zoneOffsets covers the abbreviations feeds actually use. time.Parse only
+// knows the offset of an abbreviation when it matches the local zone, so
+// everything else would silently be read as UTC. Some abbreviations are
+// ambiguous: IST is read as India Standard Time, which is far more common in
+// feeds than Irish or Israel Standard Time.
+var zoneOffsets = map[string]string{
+	"UT":   "+0000",
+	"UTC":  "+0000",
+	"GMT":  "+0000",
+	"Z":    "+0000",
+	"EST":  "-0500",
+	"EDT":  "-0400",
+	"CST":  "-0600",
+	"CDT":  "-0500",
+	"MST":  "-0700",
+	"MDT":  "-0600",
+	"PST":  "-0800",
+	"PDT":  "-0700",
+	"AKST": "-0900",
+	"AKDT": "-0800",
+	"HST":  "-1000",
+	"BST":  "+0100",
+	"IST":  "+0530",
+	"WET":  "+0000",
+	"WEST": "+0100",
+	"CET":  "+0100",
+	"CEST": "+0200",
+	"EET":  "+0200",
+	"EEST": "+0300",
+	"MSK":  "+0300",
+	"JST":  "+0900",
+	"KST":  "+0900",
+	"AEST": "+1000",
+	"AEDT": "+1100",
+	"NZST": "+1200",
+	"NZDT": "+1300",
+}
+
+var errNoPubDate = errors.New("no publication date")
+
+// normalizeZone replaces a zone abbreviation with its numeric offset. The
+// zone is usually last, but UnixDate puts it before the year.
+func normalizeZone(value string) string {
+	fields := strings.Split(value, " ")
+	for i, field := range fields {
+		if offset, ok := zoneOffsets[strings.ToUpper(field)]; ok {
+			fields[i] = offset
+		}
+	}
+	return strings.Join(fields, " ")
+}
+
+// parsePubDate parses a feed item date in any of the formats in
+// pubDateLayouts. The result is in UTC since published_at has no time zone
+// and would otherwise keep the wall clock of the feed's offset.
+func parsePubDate(value string) (time.Time, error) {
+	value = strings.Join(strings.Fields(value), " ")
+	if value == "" {
+		return time.Time{}, errNoPubDate
+	}
+
+	candidates := []string{value}
+	if normalized := normalizeZone(value); normalized != value {
+		candidates = append([]string{normalized}, candidates...)
+	}
+
+	for _, candidate := range candidates {
+		for _, layout := range pubDateLayouts {
+			parsed, err := time.Parse(layout, candidate)
+			if err == nil {
+				return parsed.UTC(), nil
+			}
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("unrecognized date format: %s", value)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParsePubDate(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Time
+	}{
+		{"Mon, 02 Jan 2006 15:04:05 -0700", time.Date(2006, 1, 2, 22, 4, 5, 0, time.UTC)},
+		{"Mon, 02 Jan 2006 15:04:05 GMT", time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)},
+		{"Mon, 02 Jan 2006 15:04:05 EST", time.Date(2006, 1, 2, 20, 4, 5, 0, time.UTC)},
+		{"Mon, 02 Jan 2006 15:04:05 pdt", time.Date(2006, 1, 2, 22, 4, 5, 0, time.UTC)},
+		{"Mon, 2 Jan 2006 15:04:05 IST", time.Date(2006, 1, 2, 9, 34, 5, 0, time.UTC)},
+		{"Mon,  2 Jan 2006\n15:04:05 +0000", time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)},
+		{"Monday, 02-Jan-06 15:04:05 EST", time.Date(2006, 1, 2, 20, 4, 5, 0, time.UTC)},
+		{"Mon Jan  2 15:04:05 EST 2006", time.Date(2006, 1, 2, 20, 4, 5, 0, time.UTC)},
+		{"Mon Jan  2 15:04:05 2006", time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)},
+		{"Mon, 2 Jan 06 15:04:05 +0100", time.Date(2006, 1, 2, 14, 4, 5, 0, time.UTC)},
+		{"02 Jan 06 15:04 CET", time.Date(2006, 1, 2, 14, 4, 0, 0, time.UTC)},
+		{"2006-01-02T15:04:05Z", time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)},
+		{"2006-01-02T15:04:05.123456+02:00", time.Date(2006, 1, 2, 13, 4, 5, 123456000, time.UTC)},
+		{"2006-01-02T15:04:05", time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)},
+		{"2006-01-02", time.Date(2006, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{"January 2, 2006", time.Date(2006, 1, 2, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, test := range tests {
+		got, err := parsePubDate(test.value)
+		if err != nil {
+			t.Errorf("parsePubDate(%q): %v", test.value, err)
+			continue
+		}
+		if !got.Equal(test.want) || got.Location() != time.UTC {
+			t.Errorf("parsePubDate(%q) = %v, want %v", test.value, got, test.want)
+		}
+	}
+}
+
+func TestParsePubDateErrors(t *testing.T) {
+	for _, value := range []string{"", "   "} {
+		_, err := parsePubDate(value)
+		if !errors.Is(err, errNoPubDate) {
+			t.Errorf("parsePubDate(%q) error = %v, want errNoPubDate", value, err)
+		}
+	}
+
+	for _, value := range []string{"yesterday", "32/13/2006", "Mon, 02 Jan 2006 25:04:05 GMT"} {
+		_, err := parsePubDate(value)
+		if err == nil || errors.Is(err, errNoPubDate) {
+			t.Errorf("parsePubDate(%q) error = %v, want unrecognized date", value, err)
+		}
+	}
+}
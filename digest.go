@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"html"
+	"html/template"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/alpsilva/config"
+	"github.com/alpsilva/go-blog-aggregator.git/internal/database"
+)
+
+const (
+	// firstDigestWindow is how far back the first digest of a user goes.
+	firstDigestWindow   = 24 * time.Hour
+	digestSnippetLength = 200
+)
+
+var errNoSMTP = errors.New("smtp is not configured. add an smtp section to the config")
+
+type digestFeed struct {
+	Name  string
+	Posts []digestPost
+}
+
+type digestPost struct {
+	Title     string
+	URL       string
+	Published string
+	Snippet   string
+}
+
+type digest struct {
+	Since time.Time
+	Count int
+	Feeds []digestFeed
+}
+
+var digestHTMLTemplate = template.Must(template.New("digest").Parse(`<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif; max-width: 40em;">
+<h1>New posts since {{.Since.Format "Jan 2 15:04"}}</h1>
+{{range .Feeds}}<h2>{{.Name}}</h2>
+<ul>
+{{range .Posts}}<li><a href="{{.URL}}">{{.Title}}</a> <small>{{.Published}}</small>{{if .Snippet}}<br>{{.Snippet}}{{end}}</li>
+{{end}}</ul>
+{{end}}</body>
+</html>
+`))
+
+func newDigest(since time.Time, posts []database.GetDigestPostsForUserRow) digest {
+	d := digest{Since: since, Count: len(posts)}
+
+	// Posts come sorted by feed name, so each feed is a run of posts.
+	for _, post := range posts {
+		if len(d.Feeds) == 0 || d.Feeds[len(d.Feeds)-1].Name != post.FeedName {
+			d.Feeds = append(d.Feeds, digestFeed{Name: post.FeedName})
+		}
+
+		// The template escapes the snippet again, so entities left by
+		// stripping the markup must be decoded first.
+		snippet := []rune(html.UnescapeString(cleanSnippet(post.Description.String)))
+		if len(snippet) > digestSnippetLength {
+			snippet = append(snippet[:digestSnippetLength], '…')
+		}
+
+		feed := &d.Feeds[len(d.Feeds)-1]
+		feed.Posts = append(feed.Posts, digestPost{
+			Title:     post.Title,
+			URL:       post.Url,
+			Published: post.PublishedAt.Format(time.DateOnly),
+			Snippet:   string(snippet),
+		})
+	}
+
+	return d
+}
+
+func (d digest) subject() string {
+	if d.Count == 1 {
+		return "gator digest: 1 new post"
+	}
+	return fmt.Sprintf("gator digest: %d new posts", d.Count)
+}
+
+func (d digest) text() string {
+	output := fmt.Sprintf("New posts since %s\n", d.Since.Format("Jan 2 15:04"))
+	for _, feed := range d.Feeds {
+		output += fmt.Sprintf("\n%s\n", feed.Name)
+		for _, post := range feed.Posts {
+			output += fmt.Sprintf("* %s (%s)\n  %s\n", post.Title, post.Published, post.URL)
+		}
+	}
+	return output
+}
+
+func writeQuotedPrintablePart(writer *multipart.Writer, contentType string, content string) error {
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", contentType)
+	header.Set("Content-Transfer-Encoding", "quoted-printable")
+
+	part, err := writer.CreatePart(header)
+	if err != nil {
+		return err
+	}
+
+	encoder := quotedprintable.NewWriter(part)
+	_, err = encoder.Write([]byte(content))
+	if err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// message renders the digest as a multipart/alternative email with a plain
+// text and an HTML version.
+func (d digest) message(from string, to string, now time.Time) ([]byte, error) {
+	htmlBody := bytes.Buffer{}
+	err := digestHTMLTemplate.Execute(&htmlBody, d)
+	if err != nil {
+		return nil, err
+	}
+
+	body := bytes.Buffer{}
+	writer := multipart.NewWriter(&body)
+	err = writeQuotedPrintablePart(writer, "text/plain; charset=utf-8", d.text())
+	if err != nil {
+		return nil, err
+	}
+	err = writeQuotedPrintablePart(writer, "text/html; charset=utf-8", htmlBody.String())
+	if err != nil {
+		return nil, err
+	}
+	err = writer.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	message := bytes.Buffer{}
+	fmt.Fprintf(&message, "From: %s\r\n", from)
+	fmt.Fprintf(&message, "To: %s\r\n", to)
+	fmt.Fprintf(&message, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", d.subject()))
+	fmt.Fprintf(&message, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	fmt.Fprintf(&message, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&message, "Content-Type: multipart/alternative; boundary=%q\r\n", writer.Boundary())
+	fmt.Fprintf(&message, "\r\n")
+	message.Write(body.Bytes())
+
+	return message.Bytes(), nil
+}
+
+func sendMail(cfg *config.SMTPConfig, to string, message []byte) error {
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if cfg.Username != "" {
+		auth = smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)
+	}
+
+	return smtp.SendMail(cfg.Addr(), auth, from.Address, []string{to}, message)
+}
+
+// sendDigest emails user the posts gator collected since their last digest.
+// With dryRun the message is printed instead and the digest is not marked
+// as sent. It returns the number of posts in the digest.
+func sendDigest(ctx context.Context, s *state, user database.User, dryRun bool) (int, error) {
+	if !user.Email.Valid {
+		return 0, fmt.Errorf("%s has no email. set one with set-email <address>", user.Name)
+	}
+	if s.cfg.SMTP == nil && !dryRun {
+		return 0, errNoSMTP
+	}
+
+	now := time.Now()
+	since := now.Add(-firstDigestWindow)
+	if user.LastDigestAt.Valid {
+		since = user.LastDigestAt.Time
+	}
+
+	posts, err := s.db.GetDigestPostsForUser(ctx, database.GetDigestPostsForUserParams{
+		UserID: user.ID,
+		Since:  since,
+		Until:  now,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	markSent := func() error {
+		return s.db.MarkDigestSent(ctx, database.MarkDigestSentParams{
+			ID:           user.ID,
+			LastDigestAt: sql.NullTime{Time: now, Valid: true},
+		})
+	}
+
+	if len(posts) == 0 {
+		// Nothing to send, but the window is covered all the same, and the
+		// user shouldn't stay due on every tick until something comes in.
+		if dryRun {
+			return 0, nil
+		}
+		return 0, markSent()
+	}
+
+	from := "gator"
+	if s.cfg.SMTP != nil {
+		from = s.cfg.SMTP.From
+	}
+
+	message, err := newDigest(since, posts).message(from, user.Email.String, now)
+	if err != nil {
+		return 0, err
+	}
+
+	if dryRun {
+		fmt.Println(strings.ReplaceAll(string(message), "\r\n", "\n"))
+		return len(posts), nil
+	}
+
+	err = sendMail(s.cfg.SMTP, user.Email.String, message)
+	if err != nil {
+		return 0, err
+	}
+
+	err = markSent()
+	if err != nil {
+		return 0, err
+	}
+
+	return len(posts), nil
+}
+
+// sendDueDigests sends a digest to every user with an email whose last one
+// is older than interval.
+func sendDueDigests(s *state, interval time.Duration) error {
+	users, err := s.db.GetUsersDueForDigest(context.Background(), sql.NullTime{Time: time.Now().Add(-interval), Valid: true})
+	if err != nil {
+		return err
+	}
+
+	errs := []error{}
+	for _, user := range users {
+		count, err := sendDigest(context.Background(), s, user, false)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("digest for %s: %w", user.Name, err))
+			continue
+		}
+		if count > 0 {
+			fmt.Printf("Sent digest of %d posts to %s\n", count, user.Email.String)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func handlerSetEmail(s *state, cmd command, user database.User) error {
+	if len(cmd.args) < 1 {
+		return errors.New("not enough arguments. needs email")
+	}
+
+	address, err := mail.ParseAddress(cmd.args[0])
+	if err != nil {
+		return err
+	}
+
+	err = s.db.SetUserEmail(context.Background(), database.SetUserEmailParams{
+		ID:    user.ID,
+		Email: sql.NullString{String: address.Address, Valid: true},
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Digests for %s will be sent to %s\n", user.Name, address.Address)
+
+	return nil
+}
+
+func handlerDigest(s *state, cmd command, user database.User) error {
+	fs := flag.NewFlagSet("digest", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "print the email instead of sending it")
+	_, err := parseArgs(fs, cmd.args)
+	if err != nil {
+		return err
+	}
+
+	count, err := sendDigest(context.Background(), s, user, *dryRun)
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		fmt.Println("No new posts since the last digest")
+		return nil
+	}
+
+	if !*dryRun {
+		fmt.Printf("Sent digest of %d posts to %s\n", count, user.Email.String)
+	}
+
+	return nil
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alpsilva/config"
+	"github.com/alpsilva/go-blog-aggregator.git/internal/database"
+	"github.com/google/uuid"
+)
+
+// startSMTPServer accepts mail on a local port and sends every message it
+// receives on the returned channel. It speaks just enough SMTP for
+// smtp.SendMail without authentication or STARTTLS.
+func startSMTPServer(t *testing.T) (*config.SMTPConfig, <-chan []byte) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	messages := make(chan []byte, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSMTP(conn, messages)
+		}
+	}()
+
+	addr := listener.Addr().(*net.TCPAddr)
+	return &config.SMTPConfig{Host: addr.IP.String(), Port: addr.Port, From: "gator <gator@example.com>"}, messages
+}
+
+func serveSMTP(conn net.Conn, messages chan<- []byte) {
+	defer conn.Close()
+
+	text := textproto.NewConn(conn)
+	text.PrintfLine("220 localhost ESMTP")
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+
+		verb, _, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			text.PrintfLine("250 localhost")
+		case "MAIL", "RCPT", "RSET", "NOOP":
+			text.PrintfLine("250 OK")
+		case "DATA":
+			text.PrintfLine("354 end data with <CR><LF>.<CR><LF>")
+			message, err := text.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			messages <- message
+			text.PrintfLine("250 OK")
+		case "QUIT":
+			text.PrintfLine("221 bye")
+			return
+		default:
+			text.PrintfLine("502 not implemented")
+		}
+	}
+}
+
+func TestSendDueDigests(t *testing.T) {
+	smtpConfig, messages := startSMTPServer(t)
+	fake, db := newFakeDB(t)
+	s := &state{db: db, cfg: &config.Config{SMTP: smtpConfig}}
+
+	user := database.User{
+		ID:    uuid.New(),
+		Name:  "jane",
+		Email: sql.NullString{String: "jane@example.com", Valid: true},
+	}
+	feedID := uuid.New()
+	post := database.GetDigestPostsForUserRow{
+		ID:          uuid.New(),
+		CreatedAt:   time.Now().Add(-time.Hour),
+		Title:       "Fish & chips",
+		Url:         "https://example.com/fish",
+		Description: sql.NullString{String: "<p>Fish &amp; chips, <b>hot</b></p>", Valid: true},
+		PublishedAt: time.Now().Add(-time.Hour),
+		FeedID:      feedID,
+		FeedName:    "Recipes",
+	}
+
+	// The answers follow the SQL: users are due when their last digest is
+	// old enough, and only posts created since then are included.
+	fake.answer("GetUsersDueForDigest", func(args []driver.Value) []any {
+		if user.LastDigestAt.Valid && user.LastDigestAt.Time.After(args[0].(time.Time)) {
+			return nil
+		}
+		return []any{user}
+	})
+	fake.answer("GetDigestPostsForUser", func(args []driver.Value) []any {
+		since, until := args[1].(time.Time), args[2].(time.Time)
+		if post.CreatedAt.After(since) && !post.CreatedAt.After(until) {
+			return []any{post}
+		}
+		return nil
+	})
+	fake.answer("MarkDigestSent", func(args []driver.Value) []any {
+		user.LastDigestAt = sql.NullTime{Time: args[1].(time.Time), Valid: true}
+		return nil
+	})
+
+	err := sendDueDigests(s, time.Hour)
+	if err != nil {
+		t.Fatalf("sendDueDigests: %v", err)
+	}
+
+	var data []byte
+	select {
+	case data = <-messages:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no digest was sent")
+	}
+
+	parts := readDigestMessage(t, data)
+	if !strings.Contains(parts["text/plain"], "Fish & chips (") || !strings.Contains(parts["text/plain"], post.Url) {
+		t.Errorf("text part is missing the post:\n%s", parts["text/plain"])
+	}
+	if !strings.Contains(parts["text/html"], `<a href="https://example.com/fish">Fish &amp; chips</a>`) {
+		t.Errorf("html part is missing the post link:\n%s", parts["text/html"])
+	}
+	if !strings.Contains(parts["text/html"], "<br>Fish &amp; chips, hot</li>") {
+		t.Errorf("html part has a badly escaped snippet:\n%s", parts["text/html"])
+	}
+
+	if !user.LastDigestAt.Valid {
+		t.Fatal("last_digest_at was not recorded")
+	}
+
+	err = sendDueDigests(s, time.Hour)
+	if err != nil {
+		t.Fatalf("sendDueDigests: %v", err)
+	}
+
+	// A user that is due again, e.g. with a shorter interval, must still
+	// not get posts that were already in a digest.
+	err = sendDueDigests(s, 0)
+	if err != nil {
+		t.Fatalf("sendDueDigests: %v", err)
+	}
+
+	select {
+	case <-messages:
+		t.Fatal("digest was sent again")
+	case <-time.After(100 * time.Millisecond):
+	}
+	// The second round was not due, the third one had an empty window.
+	if calls := len(fake.called("MarkDigestSent")); calls != 2 {
+		t.Fatalf("digest marked as sent %d times", calls)
+	}
+}
+
+func TestSendDueDigestsEmptyWindow(t *testing.T) {
+	smtpConfig, messages := startSMTPServer(t)
+	fake, db := newFakeDB(t)
+	s := &state{db: db, cfg: &config.Config{SMTP: smtpConfig}}
+
+	user := database.User{
+		ID:    uuid.New(),
+		Name:  "jane",
+		Email: sql.NullString{String: "jane@example.com", Valid: true},
+	}
+
+	fake.answer("GetUsersDueForDigest", func(args []driver.Value) []any {
+		if user.LastDigestAt.Valid && user.LastDigestAt.Time.After(args[0].(time.Time)) {
+			return nil
+		}
+		return []any{user}
+	})
+	fake.answer("MarkDigestSent", func(args []driver.Value) []any {
+		user.LastDigestAt = sql.NullTime{Time: args[1].(time.Time), Valid: true}
+		return nil
+	})
+
+	for range 2 {
+		err := sendDueDigests(s, time.Hour)
+		if err != nil {
+			t.Fatalf("sendDueDigests: %v", err)
+		}
+	}
+
+	select {
+	case <-messages:
+		t.Fatal("an empty digest was sent")
+	case <-time.After(100 * time.Millisecond):
+	}
+	if !user.LastDigestAt.Valid {
+		t.Fatal("last_digest_at was not advanced past the empty window")
+	}
+	if calls := len(fake.called("GetDigestPostsForUser")); calls != 1 {
+		t.Fatalf("user stayed due, posts were looked up %d times", calls)
+	}
+}
+
+// readDigestMessage returns the decoded parts of a multipart/alternative
+// message by content type.
+func readDigestMessage(t *testing.T, data []byte) map[string]string {
+	t.Helper()
+
+	message, err := mail.ReadMessage(bufio.NewReader(strings.NewReader(string(data))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if message.Header.Get("To") != "jane@example.com" {
+		t.Errorf("message sent to %q", message.Header.Get("To"))
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(message.Header.Get("Subject"))
+	if err != nil || subject != "gator digest: 1 new post" {
+		t.Errorf("message has subject %q", subject)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(message.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("message has content type %q", message.Header.Get("Content-Type"))
+	}
+
+	parts := map[string]string{}
+	reader := multipart.NewReader(message.Body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		body, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		partType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		parts[partType] = string(body)
+	}
+
+	if len(parts) != 2 {
+		t.Fatalf("expected a text and an html part, got %d parts", len(parts))
+	}
+
+	return parts
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+const maxDiscoveryBodyBytes = 5 << 20
+
+// commonFeedPaths are tried when a page does not advertise its feeds.
+var commonFeedPaths = []string{
+	"/feed",
+	"/rss.xml",
+	"/atom.xml",
+	"/feed.xml",
+	"/index.xml",
+	"/feed.json",
+	"/rss",
+}
+
+var feedLinkTypes = []string{
+	"application/rss+xml",
+	"application/atom+xml",
+	"application/feed+json",
+	"application/json",
+}
+
+var (
+	linkTagPattern   = regexp.MustCompile(`(?is)<(link|base)\b[^>]*>`)
+	attributePattern = regexp.MustCompile(`(?s)([a-zA-Z_:][-a-zA-Z0-9_:.]*)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+)
+
+type feedCandidate struct {
+	url   string
+	title string
+}
+
+func tagAttributes(tag string) map[string]string {
+	attributes := map[string]string{}
+	for _, match := range attributePattern.FindAllStringSubmatch(tag, -1) {
+		value := match[2] + match[3] + match[4]
+		attributes[strings.ToLower(match[1])] = html.UnescapeString(value)
+	}
+	return attributes
+}
+
+func isHTML(contentType string, data []byte) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err == nil && (mediaType == "text/html" || mediaType == "application/xhtml+xml") {
+		return true
+	}
+
+	start := strings.ToLower(string(bytes.TrimSpace(data[:min(len(data), 512)])))
+	return strings.HasPrefix(start, "<!doctype html") || strings.HasPrefix(start, "<html")
+}
+
+// feedLinks returns the feeds a page advertises with
+// <link rel="alternate" type="application/rss+xml" href="...">.
+func feedLinks(pageURL *url.URL, page []byte) []feedCandidate {
+	base := pageURL
+	candidates := []feedCandidate{}
+
+	for _, tag := range linkTagPattern.FindAllString(string(page), -1) {
+		attributes := tagAttributes(tag)
+
+		if strings.HasPrefix(strings.ToLower(tag), "<base") {
+			if href, err := pageURL.Parse(attributes["href"]); err == nil && attributes["href"] != "" {
+				base = href
+			}
+			continue
+		}
+
+		rels := strings.Fields(strings.ToLower(attributes["rel"]))
+		mediaType, _, _ := mime.ParseMediaType(attributes["type"])
+		if !slices.Contains(rels, "alternate") || !slices.Contains(feedLinkTypes, mediaType) {
+			continue
+		}
+
+		href, err := base.Parse(attributes["href"])
+		if err != nil || attributes["href"] == "" {
+			continue
+		}
+
+		if slices.ContainsFunc(candidates, func(c feedCandidate) bool { return c.url == href.String() }) {
+			continue
+		}
+
+		candidates = append(candidates, feedCandidate{url: href.String(), title: attributes["title"]})
+	}
+
+	return candidates
+}
+
+// feedPathPrefixes are the directories probeFeedPaths looks in: the one of
+// the page, so that a blog under /blog/ finds /blog/feed, then the root.
+func feedPathPrefixes(pageURL *url.URL) []string {
+	dir := strings.TrimSuffix(pageURL.Path, "/")
+	if last := dir[strings.LastIndex(dir, "/")+1:]; strings.Contains(last, ".") {
+		// A file like /blog/index.html, its directory is what counts.
+		dir = dir[:strings.LastIndex(dir, "/")]
+	}
+
+	if dir == "" {
+		return []string{""}
+	}
+	return []string{dir, ""}
+}
+
+// probeFeedPaths looks for a feed at the usual locations of the site.
+func probeFeedPaths(ctx context.Context, pageURL *url.URL) []feedCandidate {
+	for _, prefix := range feedPathPrefixes(pageURL) {
+		for _, path := range commonFeedPaths {
+			candidate := pageURL.ResolveReference(&url.URL{Path: prefix + path})
+
+			feed, _, err := fetchFeed(ctx, candidate.String(), cacheValidators{})
+			if err == nil {
+				return []feedCandidate{{url: candidate.String(), title: feed.Channel.Title}}
+			}
+		}
+	}
+	return nil
+}
+
+// discoverFeeds returns the feed URLs behind rawURL. A feed URL is returned
+// as is, a web page is searched for advertised feeds and then for feeds at
+// common paths.
+func discoverFeeds(ctx context.Context, rawURL string) ([]feedCandidate, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("User-Agent", "gator")
+
+	response, err := feedClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= 400 {
+		return nil, fmt.Errorf("unexpected status fetching %s: %s", rawURL, response.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(response.Body, maxDiscoveryBodyBytes))
+	if err != nil {
+		return nil, err
+	}
+
+	contentType := response.Header.Get("Content-Type")
+	if !isHTML(contentType, data) {
+		feed, err := parseFeed(contentType, data)
+		if err != nil {
+			return nil, err
+		}
+		return []feedCandidate{{url: rawURL, title: feed.Channel.Title}}, nil
+	}
+
+	// Relative links resolve against the page we ended up on after redirects.
+	pageURL := response.Request.URL
+
+	candidates := feedLinks(pageURL, data)
+	if len(candidates) == 0 {
+		candidates = probeFeedPaths(ctx, pageURL)
+	}
+
+	return candidates, nil
+}
+
+// resolveFeedURL turns whatever URL the user typed into the URL of a feed.
+// It fails when the page has no feed or more than one, listing the
+// candidates in the latter case so the user can pick.
+func resolveFeedURL(ctx context.Context, rawURL string) (string, error) {
+	candidates, err := discoverFeeds(ctx, rawURL)
+	if err != nil {
+		return "", err
+	}
+
+	switch len(candidates) {
+	case 0:
+		return "", fmt.Errorf("no feed found at %s", rawURL)
+	case 1:
+		return candidates[0].url, nil
+	}
+
+	message := fmt.Sprintf("%s has several feeds, use one of:", rawURL)
+	for _, candidate := range candidates {
+		message += fmt.Sprintf("\n* %s (%s)", candidate.url, candidate.title)
+	}
+
+	return "", errors.New(message)
+}
+
+// validateFeedURL resolves rawURL to a feed and fetches it, so that only
+// URLs serving a feed gator can read get added.
+func validateFeedURL(ctx context.Context, rawURL string) (string, *RSSFeed, error) {
+	feedURL, err := resolveFeedURL(ctx, rawURL)
+	if err != nil {
+		return "", nil, err
+	}
+
+	rssFeed, _, err := fetchFeed(ctx, feedURL, cacheValidators{})
+	if err != nil {
+		return "", nil, err
+	}
+
+	return feedURL, rssFeed, nil
+}
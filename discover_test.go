@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestFeedPathPrefixes(t *testing.T) {
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"", []string{""}},
+		{"/", []string{""}},
+		{"/blog", []string{"/blog", ""}},
+		{"/blog/", []string{"/blog", ""}},
+		{"/blog/index.html", []string{"/blog", ""}},
+		{"/index.html", []string{""}},
+	}
+
+	for _, test := range tests {
+		got := feedPathPrefixes(&url.URL{Path: test.path})
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("feedPathPrefixes(%q) = %q, want %q", test.path, got, test.want)
+		}
+	}
+}
+
+func TestDiscoverFeedsProbesUnderThePage(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/blog/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/blog/feed" {
+			w.Header().Set("Content-Type", "application/rss+xml")
+			w.Write([]byte(`<?xml version="1.0"?><rss version="2.0"><channel><title>The blog</title></channel></rss>`))
+			return
+		}
+		if r.URL.Path != "/blog/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head><title>The blog</title></head><body>No links here</body></html>`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	candidates, err := discoverFeeds(context.Background(), server.URL+"/blog/")
+	if err != nil {
+		t.Fatalf("discoverFeeds: %v", err)
+	}
+	if len(candidates) != 1 || candidates[0].url != server.URL+"/blog/feed" {
+		t.Fatalf("expected the feed under /blog, got %v", candidates)
+	}
+}
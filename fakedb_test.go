@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"reflect"
+	"regexp"
+	"sync"
+	"testing"
+
+	"github.com/alpsilva/go-blog-aggregator.git/internal/database"
+)
+
+var queryNamePattern = regexp.MustCompile(`^-- name: (\w+)`)
+
+// fakeDB is a database/sql driver that answers sqlc queries by name, so
+// code built on database.Queries can be tested without a Postgres server.
+// Queries without a registered answer return no rows.
+type fakeDB struct {
+	mu      sync.Mutex
+	answers map[string]func(args []driver.Value) [][]driver.Value
+	calls   []fakeCall
+}
+
+type fakeCall struct {
+	name string
+	args []driver.Value
+}
+
+func newFakeDB(t *testing.T) (*fakeDB, *database.Queries) {
+	t.Helper()
+
+	fake := &fakeDB{answers: map[string]func(args []driver.Value) [][]driver.Value{}}
+	db := sql.OpenDB(fake)
+	t.Cleanup(func() { db.Close() })
+
+	return fake, database.New(db)
+}
+
+// answer makes the query called name return rows built from the fields of
+// each value, in declaration order, which is the order sqlc scans them in.
+func (f *fakeDB) answer(name string, answer func(args []driver.Value) []any) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.answers[name] = func(args []driver.Value) [][]driver.Value {
+		rows := [][]driver.Value{}
+		for _, value := range answer(args) {
+			rows = append(rows, fakeRow(value))
+		}
+		return rows
+	}
+}
+
+// called returns the arguments of every call to the query called name.
+func (f *fakeDB) called(name string) [][]driver.Value {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	calls := [][]driver.Value{}
+	for _, call := range f.calls {
+		if call.name == name {
+			calls = append(calls, call.args)
+		}
+	}
+	return calls
+}
+
+func (f *fakeDB) run(query string, named []driver.NamedValue) [][]driver.Value {
+	name := ""
+	if match := queryNamePattern.FindStringSubmatch(query); match != nil {
+		name = match[1]
+	}
+
+	args := make([]driver.Value, len(named))
+	for i, arg := range named {
+		args[i] = arg.Value
+	}
+
+	f.mu.Lock()
+	f.calls = append(f.calls, fakeCall{name: name, args: args})
+	answer := f.answers[name]
+	f.mu.Unlock()
+
+	if answer == nil {
+		return nil
+	}
+	return answer(args)
+}
+
+func fakeRow(value any) []driver.Value {
+	v := reflect.ValueOf(value)
+	row := make([]driver.Value, v.NumField())
+	for i := range row {
+		converted, err := driver.DefaultParameterConverter.ConvertValue(v.Field(i).Interface())
+		if err != nil {
+			panic(err)
+		}
+		row[i] = converted
+	}
+	return row
+}
+
+func (f *fakeDB) Connect(ctx context.Context) (driver.Conn, error) {
+	return fakeConn{db: f}, nil
+}
+
+func (f *fakeDB) Driver() driver.Driver {
+	return fakeDriver{}
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	return nil, errors.New("fake driver only opens through a connector")
+}
+
+type fakeConn struct {
+	db *fakeDB
+}
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("fake driver does not prepare statements")
+}
+
+func (c fakeConn) Close() error {
+	return nil
+}
+
+func (c fakeConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("fake driver does not support transactions")
+}
+
+func (c fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return &fakeRows{rows: c.db.run(query, args)}, nil
+}
+
+func (c fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return driver.RowsAffected(len(c.db.run(query, args))), nil
+}
+
+type fakeRows struct {
+	rows [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string {
+	if len(r.rows) == 0 {
+		return nil
+	}
+	return make([]string, len(r.rows[0]))
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
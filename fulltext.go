@@ -0,0 +1,538 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/alpsilva/go-blog-aggregator.git/internal/database"
+	"golang.org/x/net/html"
+)
+
+const (
+	articleTimeout     = 20 * time.Second
+	maxArticleBytes    = 5 << 20
+	articleBatchSize   = 20
+	articleMaxAttempts = 5
+	// articleHostDelay is the least time between two requests to the same
+	// site, so a feed publishing many posts at once does not hammer it.
+	articleHostDelay = 2 * time.Second
+	// articleRetryBase is the wait after the first failed attempt. It
+	// doubles with every attempt up to articleMaxRetryWait.
+	articleRetryBase    = 15 * time.Minute
+	articleMaxRetryWait = 24 * time.Hour
+	// minArticleText is the least text a block needs to count as a
+	// paragraph of the article.
+	minArticleText = 25
+	// articleInterval is how often agg looks for articles to download,
+	// independently of how often it collects feeds.
+	articleInterval = time.Minute
+)
+
+var errNoArticle = errors.New("no article content found")
+
+var articleClient = &http.Client{Timeout: articleTimeout}
+
+var (
+	unlikelyCandidatePattern = regexp.MustCompile(`(?i)banner|breadcrumb|combx|comment|community|cover-wrap|disqus|extra|foot|header|legends|menu|related|remark|replies|rss|shoutbox|sidebar|skyscraper|social|sponsor|ad-break|agegate|pagination|pager|popup|share|subscribe|newsletter`)
+	maybeCandidatePattern    = regexp.MustCompile(`(?i)and|article|body|column|content|main|shadow`)
+	positiveClassPattern     = regexp.MustCompile(`(?i)article|body|content|entry|hentry|h-entry|main|page|post|text|blog|story`)
+	negativeClassPattern     = regexp.MustCompile(`(?i)hidden|banner|combx|comment|com-|contact|foot|footer|footnote|masthead|media|meta|outbrain|promo|related|scroll|share|shoutbox|sidebar|skyscraper|sponsor|shopping|tags|tool|widget|nav`)
+)
+
+// droppedArticleElements never hold article text.
+var droppedArticleElements = map[string]bool{
+	"script":   true,
+	"style":    true,
+	"noscript": true,
+	"template": true,
+	"iframe":   true,
+	"form":     true,
+	"button":   true,
+	"input":    true,
+	"select":   true,
+	"textarea": true,
+	"nav":      true,
+	"footer":   true,
+	"aside":    true,
+	"svg":      true,
+	"object":   true,
+	"embed":    true,
+	"head":     true,
+}
+
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true, "img": true,
+	"input": true, "link": true, "meta": true, "param": true, "source": true, "track": true, "wbr": true,
+}
+
+// articleElements are kept when the extracted article is written back to
+// HTML, with the attributes listed for each.
+var articleElements = map[string][]string{
+	"a": {"href"}, "b": nil, "blockquote": nil, "br": nil, "code": nil, "dd": nil, "dl": nil,
+	"div": nil, "dt": nil, "em": nil, "figcaption": nil, "figure": nil, "h1": nil, "h2": nil, "h3": nil,
+	"h4": nil, "h5": nil, "h6": nil, "hr": nil, "i": nil, "img": {"src", "alt"}, "li": nil,
+	"ol": nil, "p": nil, "pre": nil, "strong": nil, "table": nil, "td": nil, "th": nil, "tr": nil,
+	"ul": nil,
+}
+
+// htmlNode is an element or, when name is empty, a run of text.
+type htmlNode struct {
+	name     string
+	attrs    map[string]string
+	text     string
+	parent   *htmlNode
+	children []*htmlNode
+	score    float64
+	scored   bool
+}
+
+func (n *htmlNode) append(child *htmlNode) {
+	child.parent = n
+	n.children = append(n.children, child)
+}
+
+// parseHTMLTree parses a page the way browsers do, closing the elements
+// left open, and returns it as a tree of htmlNodes.
+func parseHTMLTree(markup string) *htmlNode {
+	root := &htmlNode{name: "#document"}
+
+	document, err := html.Parse(strings.NewReader(markup))
+	if err != nil {
+		// Only reading markup can fail, and a string can always be read.
+		return root
+	}
+
+	var convert func(parent *htmlNode, node *html.Node)
+	convert = func(parent *htmlNode, node *html.Node) {
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			switch child.Type {
+			case html.TextNode:
+				parent.append(&htmlNode{text: child.Data})
+			case html.ElementNode:
+				element := &htmlNode{name: child.Data, attrs: map[string]string{}}
+				for _, attr := range child.Attr {
+					element.attrs[attr.Key] = attr.Val
+				}
+				parent.append(element)
+				convert(element, child)
+			}
+		}
+	}
+	convert(root, document)
+
+	return root
+}
+
+// innerText is the text of the node with collapsed whitespace.
+func (n *htmlNode) innerText() string {
+	text := strings.Builder{}
+	var walk func(*htmlNode)
+	walk = func(node *htmlNode) {
+		if node.name == "" {
+			text.WriteString(node.text)
+			text.WriteByte(' ')
+			return
+		}
+		for _, child := range node.children {
+			walk(child)
+		}
+	}
+	walk(n)
+	return strings.Join(strings.Fields(text.String()), " ")
+}
+
+// linkDensity is the share of the text of the node that is inside links.
+func (n *htmlNode) linkDensity() float64 {
+	length := len(n.innerText())
+	if length == 0 {
+		return 0
+	}
+
+	linkLength := 0
+	for _, link := range n.findAll("a") {
+		linkLength += len(link.innerText())
+	}
+	return float64(linkLength) / float64(length)
+}
+
+func (n *htmlNode) findAll(names ...string) []*htmlNode {
+	found := []*htmlNode{}
+	var walk func(*htmlNode)
+	walk = func(node *htmlNode) {
+		for _, child := range node.children {
+			if slices.Contains(names, child.name) {
+				found = append(found, child)
+			}
+			walk(child)
+		}
+	}
+	walk(n)
+	return found
+}
+
+func (n *htmlNode) classAndID() string {
+	return n.attrs["class"] + " " + n.attrs["id"]
+}
+
+// classWeight favors elements whose class or id suggests content.
+func (n *htmlNode) classWeight() float64 {
+	weight := 0.0
+	for _, value := range []string{n.attrs["class"], n.attrs["id"]} {
+		if value == "" {
+			continue
+		}
+		if negativeClassPattern.MatchString(value) {
+			weight -= 25
+		}
+		if positiveClassPattern.MatchString(value) {
+			weight += 25
+		}
+	}
+	return weight
+}
+
+// removeClutter drops the elements that are not part of the article, like
+// scripts, navigation and comment sections.
+func removeClutter(node *htmlNode) {
+	kept := node.children[:0]
+	for _, child := range node.children {
+		if child.name != "" {
+			if droppedArticleElements[child.name] {
+				continue
+			}
+			classAndID := child.classAndID()
+			if child.name != "body" && child.name != "article" && child.name != "a" &&
+				unlikelyCandidatePattern.MatchString(classAndID) && !maybeCandidatePattern.MatchString(classAndID) {
+				continue
+			}
+			removeClutter(child)
+		}
+		kept = append(kept, child)
+	}
+	node.children = kept
+}
+
+func (n *htmlNode) initScore() {
+	if n.scored {
+		return
+	}
+	n.scored = true
+
+	switch n.name {
+	case "div", "article", "section", "main":
+		n.score = 5
+	case "pre", "td", "blockquote":
+		n.score = 3
+	case "address", "ol", "ul", "dl", "dd", "dt", "li":
+		n.score = -3
+	case "h1", "h2", "h3", "h4", "h5", "h6", "th":
+		n.score = -5
+	}
+	n.score += n.classWeight()
+}
+
+// extractArticle finds the main content of a page with the scoring of
+// Arc90's Readability: paragraphs give points to their parents, and the
+// best scoring element along with its related siblings is the article.
+// Relative links in the result are resolved against pageURL.
+func extractArticle(page string, pageURL *url.URL) (string, error) {
+	root := parseHTMLTree(page)
+	removeClutter(root)
+
+	candidates := []*htmlNode{}
+	for _, paragraph := range root.findAll("p", "pre", "td") {
+		text := paragraph.innerText()
+		if len(text) < minArticleText || paragraph.parent == nil {
+			continue
+		}
+
+		score := 1 + float64(strings.Count(text, ",")) + math.Min(float64(len(text))/100, 3)
+
+		parent := paragraph.parent
+		if !parent.scored {
+			parent.initScore()
+			candidates = append(candidates, parent)
+		}
+		parent.score += score
+
+		if grandparent := parent.parent; grandparent != nil && grandparent.name != "#document" {
+			if !grandparent.scored {
+				grandparent.initScore()
+				candidates = append(candidates, grandparent)
+			}
+			grandparent.score += score / 2
+		}
+	}
+
+	var top *htmlNode
+	for _, candidate := range candidates {
+		candidate.score *= 1 - candidate.linkDensity()
+		if top == nil || candidate.score > top.score {
+			top = candidate
+		}
+	}
+	if top == nil {
+		return "", errNoArticle
+	}
+
+	// Articles are often split in sibling blocks, say by an image or a
+	// quote, keep the ones that look like they belong.
+	threshold := math.Max(10, top.score*0.2)
+	siblings := []*htmlNode{top}
+	if top.parent != nil {
+		siblings = top.parent.children
+	}
+	article := []*htmlNode{}
+	for _, sibling := range siblings {
+		if sibling == top {
+			article = append(article, sibling)
+			continue
+		}
+		if sibling.name == "" {
+			continue
+		}
+
+		bonus := 0.0
+		if sibling.attrs["class"] != "" && sibling.attrs["class"] == top.attrs["class"] {
+			bonus = top.score * 0.2
+		}
+		if sibling.scored && sibling.score+bonus >= threshold {
+			article = append(article, sibling)
+			continue
+		}
+		if sibling.name == "p" {
+			text := sibling.innerText()
+			density := sibling.linkDensity()
+			if len(text) > 80 && density < 0.25 || len(text) > 0 && density == 0 && strings.HasSuffix(text, ".") {
+				article = append(article, sibling)
+			}
+		}
+	}
+
+	content := strings.Builder{}
+	for _, node := range article {
+		writeArticleHTML(&content, node, pageURL)
+	}
+
+	output := strings.TrimSpace(content.String())
+	if output == "" {
+		return "", errNoArticle
+	}
+	return output, nil
+}
+
+// writeArticleHTML writes node back as HTML, keeping only the elements
+// and attributes of articleElements with absolute links.
+func writeArticleHTML(output *strings.Builder, node *htmlNode, pageURL *url.URL) {
+	if node.name == "" {
+		output.WriteString(html.EscapeString(node.text))
+		return
+	}
+
+	attributes, keep := articleElements[node.name]
+	if keep {
+		output.WriteString("<" + node.name)
+		for _, name := range attributes {
+			value, ok := node.attrs[name]
+			if !ok {
+				continue
+			}
+			if name == "href" || name == "src" {
+				link, err := pageURL.Parse(strings.TrimSpace(value))
+				if err != nil {
+					continue
+				}
+				value = link.String()
+			}
+			fmt.Fprintf(output, " %s=\"%s\"", name, html.EscapeString(value))
+		}
+		output.WriteString(">")
+		if voidElements[node.name] {
+			return
+		}
+	}
+
+	for _, child := range node.children {
+		writeArticleHTML(output, child, pageURL)
+	}
+
+	if keep {
+		output.WriteString("</" + node.name + ">")
+	}
+}
+
+// fetchArticle downloads the page of a post and returns its main content.
+func fetchArticle(ctx context.Context, articleURL string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", articleURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Add("User-Agent", "gator")
+	req.Header.Add("Accept", "text/html,application/xhtml+xml")
+
+	response, err := articleClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= 400 {
+		return "", fmt.Errorf("unexpected status fetching %s: %s", articleURL, response.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(response.Body, maxArticleBytes))
+	if err != nil {
+		return "", err
+	}
+
+	if !isHTML(response.Header.Get("Content-Type"), data) {
+		return "", fmt.Errorf("%s is not a web page", articleURL)
+	}
+
+	// Relative links resolve against the page we ended up on after redirects.
+	return extractArticle(string(data), response.Request.URL)
+}
+
+// articleRetryWait is how long to wait before the next attempt once a
+// fetch has failed attempts times.
+func articleRetryWait(attempts int32) time.Duration {
+	wait := articleRetryBase
+	for range attempts - 1 {
+		wait *= 2
+		if wait >= articleMaxRetryWait {
+			return articleMaxRetryWait
+		}
+	}
+	return wait
+}
+
+// hostLimiter spaces out requests to the same host.
+type hostLimiter struct {
+	delay time.Duration
+	last  map[string]time.Time
+}
+
+func (l *hostLimiter) wait(ctx context.Context, host string) error {
+	if last, ok := l.last[host]; ok {
+		select {
+		case <-time.After(time.Until(last.Add(l.delay))):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	l.last[host] = time.Now()
+	return nil
+}
+
+// fetchFullContent downloads the articles of the new posts of feeds with
+// full content on, scheduling a retry with exponential backoff for the ones
+// that fail.
+func fetchFullContent(ctx context.Context, db *database.Queries) error {
+	fetches, err := db.ClaimContentFetches(ctx, database.ClaimContentFetchesParams{
+		// Nobody else picks the posts up while they are being fetched.
+		LeaseUntil:  time.Now().Add(articleBatchSize * (articleTimeout + articleHostDelay)),
+		MaxAttempts: articleMaxAttempts,
+		MaxFetches:  articleBatchSize,
+	})
+	if err != nil {
+		return err
+	}
+
+	limiter := hostLimiter{delay: articleHostDelay, last: map[string]time.Time{}}
+
+	errs := []error{}
+	for _, fetch := range fetches {
+		var content string
+		articleURL, fetchErr := url.Parse(fetch.Url)
+		if fetchErr == nil && articleURL.Scheme != "http" && articleURL.Scheme != "https" {
+			fetchErr = fmt.Errorf("cannot fetch %q", fetch.Url)
+		}
+		if fetchErr == nil {
+			fetchErr = limiter.wait(ctx, articleURL.Host)
+		}
+		if fetchErr == nil {
+			content, fetchErr = fetchArticle(ctx, fetch.Url)
+		}
+
+		if fetchErr == nil {
+			err = db.MarkContentFetched(ctx, database.MarkContentFetchedParams{
+				PostID:  fetch.PostID,
+				Content: sql.NullString{String: content, Valid: true},
+			})
+			if err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+
+		attempts := fetch.Attempts + 1
+		if attempts >= articleMaxAttempts {
+			fmt.Printf("giving up on the full content of '%s' after %d attempts: %s\n", fetch.Title, attempts, fetchErr)
+		} else {
+			fmt.Printf("error fetching the full content of '%s': %s\n", fetch.Title, fetchErr)
+		}
+
+		err = db.RecordContentFetchFailure(ctx, database.RecordContentFetchFailureParams{
+			PostID:        fetch.PostID,
+			LastError:     sql.NullString{String: fetchErr.Error(), Valid: true},
+			NextAttemptAt: time.Now().Add(articleRetryWait(attempts)),
+		})
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func handlerFeedFullText(s *state, args []string) error {
+	if len(args) < 2 || (args[1] != "on" && args[1] != "off") {
+		return errors.New("usage: feed fulltext <url> on|off")
+	}
+
+	feed, err := s.db.SetFeedFetchFullContent(context.Background(), database.SetFeedFetchFullContentParams{
+		Url:              args[0],
+		FetchFullContent: args[1] == "on",
+	})
+	if err != nil {
+		return err
+	}
+
+	if feed.FetchFullContent {
+		fmt.Printf("Full articles of new posts of %s will be downloaded\n", feed.Name)
+	} else {
+		fmt.Printf("Full articles of %s will no longer be downloaded\n", feed.Name)
+	}
+
+	return nil
+}
+
+// fetchFullContentLoop downloads articles on its own ticker until ctx is
+// done, so slow sites don't hold up collecting feeds.
+func fetchFullContentLoop(ctx context.Context, db *database.Queries) {
+	ticker := time.NewTicker(articleInterval)
+	defer ticker.Stop()
+
+	for {
+		err := fetchFullContent(ctx, db)
+		if err != nil && ctx.Err() == nil {
+			fmt.Println(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alpsilva/go-blog-aggregator.git/internal/database"
+	"github.com/google/uuid"
+)
+
+func readFixture(t *testing.T, name string) string {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestExtractArticle(t *testing.T) {
+	pageURL, err := url.Parse("https://example.com/garden/tomatoes.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		fixture string
+		want    []string
+		wantNot []string
+		wantErr error
+	}{
+		{
+			fixture: "article.html",
+			want: []string{
+				"<p>Tomatoes grow surprisingly well in pots",
+				"<p>Pick a determinate variety",
+				`<img src="https://example.com/images/tomatoes.jpg" alt="Tomatoes on a balcony">`,
+				`<a href="https://example.com/garden/feeding.html">our feeding guide</a>`,
+			},
+			wantNot: []string{"newsletter", "Great post", "Copyright", "tracking", "Archive", "font-family"},
+		},
+		{
+			// The paragraph hangs off the document itself.
+			fixture: "fragment.html",
+			want:    []string{"<p>Just a paragraph of text, sitting right under the document"},
+		},
+		{
+			fixture: "empty.html",
+			wantErr: errNoArticle,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.fixture, func(t *testing.T) {
+			article, err := extractArticle(readFixture(t, test.fixture), pageURL)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("extractArticle error = %v, want %v", err, test.wantErr)
+			}
+
+			for _, want := range test.want {
+				if !strings.Contains(article, want) {
+					t.Errorf("article is missing %q:\n%s", want, article)
+				}
+			}
+			for _, wantNot := range test.wantNot {
+				if strings.Contains(article, wantNot) {
+					t.Errorf("article contains %q:\n%s", wantNot, article)
+				}
+			}
+		})
+	}
+}
+
+func TestParseHTMLTreeMalformed(t *testing.T) {
+	tests := []struct {
+		name       string
+		markup     string
+		text       string
+		paragraphs int
+	}{
+		{"stray <", "<p>1 <3 2 > 0</p>", "1 <3 2 > 0", 1},
+		{"unclosed tags", "<div><p>first<p>second<b>bold", "first second bold", 2},
+		{"unclosed attribute", `<p>before</p><p class="x>after`, "before", 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			root := parseHTMLTree(test.markup)
+			if text := root.innerText(); text != test.text {
+				t.Errorf("text is %q, want %q", text, test.text)
+			}
+
+			paragraphs := root.findAll("p")
+			if len(paragraphs) != test.paragraphs {
+				t.Fatalf("found %d paragraphs, want %d", len(paragraphs), test.paragraphs)
+			}
+			for _, paragraph := range paragraphs {
+				if len(paragraph.findAll("p")) > 0 {
+					t.Errorf("paragraph %q holds another one", paragraph.innerText())
+				}
+			}
+		})
+	}
+}
+
+func TestFetchFullContent(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(readFixture(t, "fragment.html")))
+	}))
+	defer server.Close()
+
+	fake, db := newFakeDB(t)
+
+	fetched := database.ClaimContentFetchesRow{PostID: uuid.New(), Title: "Fragment", Url: server.URL + "/fragment"}
+	failed := database.ClaimContentFetchesRow{PostID: uuid.New(), Title: "Not a web page", Url: "ftp://example.com/post"}
+	fake.answer("ClaimContentFetches", func(args []driver.Value) []any {
+		return []any{fetched, failed}
+	})
+
+	err := fetchFullContent(context.Background(), db)
+	if err != nil {
+		t.Fatalf("fetchFullContent: %v", err)
+	}
+
+	marked := fake.called("MarkContentFetched")
+	if len(marked) != 1 || marked[0][0] != fetched.PostID.String() {
+		t.Fatalf("expected the fragment to be marked as fetched, got %v", marked)
+	}
+	if content, _ := marked[0][1].(string); !strings.Contains(content, "Just a paragraph") {
+		t.Errorf("stored content is %q", content)
+	}
+
+	failures := fake.called("RecordContentFetchFailure")
+	if len(failures) != 1 || failures[0][0] != failed.PostID.String() {
+		t.Fatalf("expected a failure for the ftp post, got %v", failures)
+	}
+}
+
+func TestFetchFullContentLoopStops(t *testing.T) {
+	fake, db := newFakeDB(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		fetchFullContentLoop(ctx, db)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(fake.called("ClaimContentFetches")) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("articles were never claimed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("loop kept running after shutdown")
+	}
+}
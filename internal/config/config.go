@@ -2,14 +2,61 @@ package config
 
 import (
 	"encoding/json"
+	"net"
 	"os"
+	"strconv"
 )
 
 const configFileName = ".gatorconfig.json"
 
+const defaultMaxFeedFailures = 5
+
+const defaultSMTPPort = 587
+
+const defaultBrowseLimit = 2
+
 type Config struct {
-	DbUrl           string `json:"db_url"`
-	CurrentUserName string `json:"current_user_name"`
+	DbUrl           string      `json:"db_url"`
+	CurrentUserName string      `json:"current_user_name"`
+	MaxFeedFailures int         `json:"max_feed_failures,omitempty"`
+	BrowseLimit     int         `json:"browse_limit,omitempty"`
+	SMTP            *SMTPConfig `json:"smtp,omitempty"`
+}
+
+// SMTPConfig is the mail server digests are sent through.
+type SMTPConfig struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	From     string `json:"from"`
+}
+
+// Addr is the host:port of the server, port 587 unless set.
+func (smtp SMTPConfig) Addr() string {
+	port := smtp.Port
+	if port == 0 {
+		port = defaultSMTPPort
+	}
+	return net.JoinHostPort(smtp.Host, strconv.Itoa(port))
+}
+
+// FeedFailureLimit is the number of consecutive failed fetches a feed may
+// have. It gets disabled when it fails more times than that.
+func (cfg Config) FeedFailureLimit() int {
+	if cfg.MaxFeedFailures <= 0 {
+		return defaultMaxFeedFailures
+	}
+	return cfg.MaxFeedFailures
+}
+
+// BrowsePageSize is the number of posts browse shows when not told
+// otherwise.
+func (cfg Config) BrowsePageSize() int {
+	if cfg.BrowseLimit <= 0 {
+		return defaultBrowseLimit
+	}
+	return cfg.BrowseLimit
 }
 
 func (cfg Config) write() error {
@@ -87,7 +87,14 @@ func (q *Queries) DeleteFeedFollow(ctx context.Context, arg DeleteFeedFollowPara
 }
 
 const getFeedFollowsForUser = `-- name: GetFeedFollowsForUser :many
-SELECT u.name AS user_name, f.id, f.created_at, f.updated_at, f.user_id, f.name, f.url, f.last_fetched_at
+SELECT u.name AS user_name, f.id, f.created_at, f.updated_at, f.user_id, f.name, f.url, f.last_fetched_at, f.etag, f.last_modified, f.last_error, f.failure_count, f.last_success_at, f.disabled, f.next_fetch_at, f.fetch_interval_seconds, f.description, f.site_url, f.language, f.image_url, f.fetch_full_content, f.leased_until, (
+    SELECT COUNT(*)
+    FROM posts p
+    LEFT JOIN post_states ps ON ps.post_id = p.id AND ps.user_id = ff.user_id
+    WHERE p.feed_id = f.id
+    AND ps.read_at IS NULL
+    AND ps.hidden_at IS NULL
+) AS unread_count
 FROM feed_follows ff
 INNER JOIN users u ON ff.user_id = u.id
 INNER JOIN feeds f ON ff.feed_id = f.id
@@ -95,14 +102,29 @@ WHERE ff.user_id = $1
 `
 
 type GetFeedFollowsForUserRow struct {
-	UserName      string
-	ID            uuid.UUID
-	CreatedAt     time.Time
-	UpdatedAt     time.Time
-	UserID        uuid.UUID
-	Name          string
-	Url           string
-	LastFetchedAt sql.NullTime
+	UserName             string
+	ID                   uuid.UUID
+	CreatedAt            time.Time
+	UpdatedAt            time.Time
+	UserID               uuid.UUID
+	Name                 string
+	Url                  string
+	LastFetchedAt        sql.NullTime
+	Etag                 sql.NullString
+	LastModified         sql.NullString
+	LastError            sql.NullString
+	FailureCount         int32
+	LastSuccessAt        sql.NullTime
+	Disabled             bool
+	NextFetchAt          sql.NullTime
+	FetchIntervalSeconds int32
+	Description          sql.NullString
+	SiteUrl              sql.NullString
+	Language             sql.NullString
+	ImageUrl             sql.NullString
+	FetchFullContent     bool
+	LeasedUntil          sql.NullTime
+	UnreadCount          int64
 }
 
 func (q *Queries) GetFeedFollowsForUser(ctx context.Context, userID uuid.UUID) ([]GetFeedFollowsForUserRow, error) {
@@ -123,6 +145,21 @@ func (q *Queries) GetFeedFollowsForUser(ctx context.Context, userID uuid.UUID) (
 			&i.Name,
 			&i.Url,
 			&i.LastFetchedAt,
+			&i.Etag,
+			&i.LastModified,
+			&i.LastError,
+			&i.FailureCount,
+			&i.LastSuccessAt,
+			&i.Disabled,
+			&i.NextFetchAt,
+			&i.FetchIntervalSeconds,
+			&i.Description,
+			&i.SiteUrl,
+			&i.Language,
+			&i.ImageUrl,
+			&i.FetchFullContent,
+			&i.LeasedUntil,
+			&i.UnreadCount,
 		); err != nil {
 			return nil, err
 		}
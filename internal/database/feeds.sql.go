@@ -7,11 +7,133 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+const claimFeed = `-- name: ClaimFeed :one
+UPDATE feeds
+SET
+updated_at = NOW(),
+last_fetched_at = NOW(),
+next_fetch_at = $1::timestamp,
+leased_until = $1::timestamp
+WHERE id = (
+    SELECT id
+    FROM feeds
+    WHERE feeds.id = $2
+    AND NOT disabled
+    AND (leased_until IS NULL OR leased_until <= NOW())
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING id, created_at, updated_at, user_id, name, url, last_fetched_at, etag, last_modified, last_error, failure_count, last_success_at, disabled, next_fetch_at, fetch_interval_seconds, description, site_url, language, image_url, fetch_full_content, leased_until
+`
+
+type ClaimFeedParams struct {
+	LeaseUntil time.Time
+	ID         uuid.UUID
+}
+
+func (q *Queries) ClaimFeed(ctx context.Context, arg ClaimFeedParams) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, claimFeed, arg.LeaseUntil, arg.ID)
+	var i Feed
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.Name,
+		&i.Url,
+		&i.LastFetchedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.LastError,
+		&i.FailureCount,
+		&i.LastSuccessAt,
+		&i.Disabled,
+		&i.NextFetchAt,
+		&i.FetchIntervalSeconds,
+		&i.Description,
+		&i.SiteUrl,
+		&i.Language,
+		&i.ImageUrl,
+		&i.FetchFullContent,
+		&i.LeasedUntil,
+	)
+	return i, err
+}
+
+const claimFeedsToFetch = `-- name: ClaimFeedsToFetch :many
+UPDATE feeds
+SET
+updated_at = NOW(),
+last_fetched_at = NOW(),
+next_fetch_at = $1::timestamp,
+leased_until = $1::timestamp
+WHERE id IN (
+    SELECT id
+    FROM feeds
+    WHERE NOT disabled
+    AND (next_fetch_at IS NULL OR next_fetch_at <= NOW())
+    ORDER BY next_fetch_at ASC NULLS FIRST, last_fetched_at ASC NULLS FIRST
+    LIMIT $2
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING id, created_at, updated_at, user_id, name, url, last_fetched_at, etag, last_modified, last_error, failure_count, last_success_at, disabled, next_fetch_at, fetch_interval_seconds, description, site_url, language, image_url, fetch_full_content, leased_until
+`
+
+type ClaimFeedsToFetchParams struct {
+	LeaseUntil time.Time
+	MaxFeeds   int32
+}
+
+func (q *Queries) ClaimFeedsToFetch(ctx context.Context, arg ClaimFeedsToFetchParams) ([]Feed, error) {
+	rows, err := q.db.QueryContext(ctx, claimFeedsToFetch, arg.LeaseUntil, arg.MaxFeeds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Feed
+	for rows.Next() {
+		var i Feed
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.Name,
+			&i.Url,
+			&i.LastFetchedAt,
+			&i.Etag,
+			&i.LastModified,
+			&i.LastError,
+			&i.FailureCount,
+			&i.LastSuccessAt,
+			&i.Disabled,
+			&i.NextFetchAt,
+			&i.FetchIntervalSeconds,
+			&i.Description,
+			&i.SiteUrl,
+			&i.Language,
+			&i.ImageUrl,
+			&i.FetchFullContent,
+			&i.LeasedUntil,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const createFeed = `-- name: CreateFeed :one
 INSERT INTO feeds (id, created_at, updated_at, user_id, name, url)
 VALUES (
@@ -22,7 +144,7 @@ VALUES (
     $5,
     $6
 )
-RETURNING id, created_at, updated_at, user_id, name, url, last_fetched_at
+RETURNING id, created_at, updated_at, user_id, name, url, last_fetched_at, etag, last_modified, last_error, failure_count, last_success_at, disabled, next_fetch_at, fetch_interval_seconds, description, site_url, language, image_url, fetch_full_content, leased_until
 `
 
 type CreateFeedParams struct {
@@ -52,12 +174,101 @@ func (q *Queries) CreateFeed(ctx context.Context, arg CreateFeedParams) (Feed, e
 		&i.Name,
 		&i.Url,
 		&i.LastFetchedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.LastError,
+		&i.FailureCount,
+		&i.LastSuccessAt,
+		&i.Disabled,
+		&i.NextFetchAt,
+		&i.FetchIntervalSeconds,
+		&i.Description,
+		&i.SiteUrl,
+		&i.Language,
+		&i.ImageUrl,
+		&i.FetchFullContent,
+		&i.LeasedUntil,
+	)
+	return i, err
+}
+
+const enableFeed = `-- name: EnableFeed :one
+UPDATE feeds
+SET
+updated_at = NOW(),
+disabled = FALSE,
+failure_count = 0,
+last_error = NULL
+WHERE url = $1
+RETURNING id, created_at, updated_at, user_id, name, url, last_fetched_at, etag, last_modified, last_error, failure_count, last_success_at, disabled, next_fetch_at, fetch_interval_seconds, description, site_url, language, image_url, fetch_full_content, leased_until
+`
+
+func (q *Queries) EnableFeed(ctx context.Context, url string) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, enableFeed, url)
+	var i Feed
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.Name,
+		&i.Url,
+		&i.LastFetchedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.LastError,
+		&i.FailureCount,
+		&i.LastSuccessAt,
+		&i.Disabled,
+		&i.NextFetchAt,
+		&i.FetchIntervalSeconds,
+		&i.Description,
+		&i.SiteUrl,
+		&i.Language,
+		&i.ImageUrl,
+		&i.FetchFullContent,
+		&i.LeasedUntil,
+	)
+	return i, err
+}
+
+const getFeedById = `-- name: GetFeedById :one
+SELECT id, created_at, updated_at, user_id, name, url, last_fetched_at, etag, last_modified, last_error, failure_count, last_success_at, disabled, next_fetch_at, fetch_interval_seconds, description, site_url, language, image_url, fetch_full_content, leased_until
+FROM feeds
+WHERE feeds.id = $1
+`
+
+func (q *Queries) GetFeedById(ctx context.Context, id uuid.UUID) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, getFeedById, id)
+	var i Feed
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.Name,
+		&i.Url,
+		&i.LastFetchedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.LastError,
+		&i.FailureCount,
+		&i.LastSuccessAt,
+		&i.Disabled,
+		&i.NextFetchAt,
+		&i.FetchIntervalSeconds,
+		&i.Description,
+		&i.SiteUrl,
+		&i.Language,
+		&i.ImageUrl,
+		&i.FetchFullContent,
+		&i.LeasedUntil,
 	)
 	return i, err
 }
 
 const getFeedByUrl = `-- name: GetFeedByUrl :one
-SELECT id, created_at, updated_at, user_id, name, url, last_fetched_at
+SELECT id, created_at, updated_at, user_id, name, url, last_fetched_at, etag, last_modified, last_error, failure_count, last_success_at, disabled, next_fetch_at, fetch_interval_seconds, description, site_url, language, image_url, fetch_full_content, leased_until
 FROM feeds
 WHERE feeds.url = $1
 `
@@ -73,12 +284,26 @@ func (q *Queries) GetFeedByUrl(ctx context.Context, url string) (Feed, error) {
 		&i.Name,
 		&i.Url,
 		&i.LastFetchedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.LastError,
+		&i.FailureCount,
+		&i.LastSuccessAt,
+		&i.Disabled,
+		&i.NextFetchAt,
+		&i.FetchIntervalSeconds,
+		&i.Description,
+		&i.SiteUrl,
+		&i.Language,
+		&i.ImageUrl,
+		&i.FetchFullContent,
+		&i.LeasedUntil,
 	)
 	return i, err
 }
 
 const getFeeds = `-- name: GetFeeds :many
-SELECT id, created_at, updated_at, user_id, name, url, last_fetched_at
+SELECT id, created_at, updated_at, user_id, name, url, last_fetched_at, etag, last_modified, last_error, failure_count, last_success_at, disabled, next_fetch_at, fetch_interval_seconds, description, site_url, language, image_url, fetch_full_content, leased_until
 FROM feeds
 `
 
@@ -99,6 +324,20 @@ func (q *Queries) GetFeeds(ctx context.Context) ([]Feed, error) {
 			&i.Name,
 			&i.Url,
 			&i.LastFetchedAt,
+			&i.Etag,
+			&i.LastModified,
+			&i.LastError,
+			&i.FailureCount,
+			&i.LastSuccessAt,
+			&i.Disabled,
+			&i.NextFetchAt,
+			&i.FetchIntervalSeconds,
+			&i.Description,
+			&i.SiteUrl,
+			&i.Language,
+			&i.ImageUrl,
+			&i.FetchFullContent,
+			&i.LeasedUntil,
 		); err != nil {
 			return nil, err
 		}
@@ -113,15 +352,104 @@ func (q *Queries) GetFeeds(ctx context.Context) ([]Feed, error) {
 	return items, nil
 }
 
-const getNextFeedToFetch = `-- name: GetNextFeedToFetch :one
-SELECT id, created_at, updated_at, user_id, name, url, last_fetched_at
-FROM feeds
-ORDER BY last_fetched_at ASC NULLS FIRST
-LIMIT 1
+const recordFeedFailure = `-- name: RecordFeedFailure :one
+UPDATE feeds
+SET
+updated_at = NOW(),
+last_error = $1,
+failure_count = failure_count + 1,
+disabled = failure_count + 1 > $2::int
+WHERE id = $3
+RETURNING id, created_at, updated_at, user_id, name, url, last_fetched_at, etag, last_modified, last_error, failure_count, last_success_at, disabled, next_fetch_at, fetch_interval_seconds, description, site_url, language, image_url, fetch_full_content, leased_until
+`
+
+type RecordFeedFailureParams struct {
+	LastError   sql.NullString
+	MaxFailures int32
+	ID          uuid.UUID
+}
+
+func (q *Queries) RecordFeedFailure(ctx context.Context, arg RecordFeedFailureParams) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, recordFeedFailure, arg.LastError, arg.MaxFailures, arg.ID)
+	var i Feed
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.Name,
+		&i.Url,
+		&i.LastFetchedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.LastError,
+		&i.FailureCount,
+		&i.LastSuccessAt,
+		&i.Disabled,
+		&i.NextFetchAt,
+		&i.FetchIntervalSeconds,
+		&i.Description,
+		&i.SiteUrl,
+		&i.Language,
+		&i.ImageUrl,
+		&i.FetchFullContent,
+		&i.LeasedUntil,
+	)
+	return i, err
+}
+
+const recordFeedSuccess = `-- name: RecordFeedSuccess :exec
+UPDATE feeds
+SET
+updated_at = NOW(),
+last_error = NULL,
+failure_count = 0,
+last_success_at = NOW()
+WHERE id = $1
+`
+
+func (q *Queries) RecordFeedSuccess(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, recordFeedSuccess, id)
+	return err
+}
+
+const scheduleFeedFetch = `-- name: ScheduleFeedFetch :exec
+UPDATE feeds
+SET
+updated_at = NOW(),
+next_fetch_at = $2,
+fetch_interval_seconds = $3,
+leased_until = NULL
+WHERE id = $1
+`
+
+type ScheduleFeedFetchParams struct {
+	ID                   uuid.UUID
+	NextFetchAt          sql.NullTime
+	FetchIntervalSeconds int32
+}
+
+func (q *Queries) ScheduleFeedFetch(ctx context.Context, arg ScheduleFeedFetchParams) error {
+	_, err := q.db.ExecContext(ctx, scheduleFeedFetch, arg.ID, arg.NextFetchAt, arg.FetchIntervalSeconds)
+	return err
+}
+
+const setFeedFetchFullContent = `-- name: SetFeedFetchFullContent :one
+UPDATE feeds
+SET
+updated_at = NOW(),
+fetch_full_content = $2
+WHERE url = $1
+RETURNING id, created_at, updated_at, user_id, name, url, last_fetched_at, etag, last_modified, last_error, failure_count, last_success_at, disabled, next_fetch_at, fetch_interval_seconds, description, site_url, language, image_url, fetch_full_content, leased_until
 `
 
-func (q *Queries) GetNextFeedToFetch(ctx context.Context) (Feed, error) {
-	row := q.db.QueryRowContext(ctx, getNextFeedToFetch)
+type SetFeedFetchFullContentParams struct {
+	Url              string
+	FetchFullContent bool
+}
+
+func (q *Queries) SetFeedFetchFullContent(ctx context.Context, arg SetFeedFetchFullContentParams) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, setFeedFetchFullContent, arg.Url, arg.FetchFullContent)
 	var i Feed
 	err := row.Scan(
 		&i.ID,
@@ -131,19 +459,70 @@ func (q *Queries) GetNextFeedToFetch(ctx context.Context) (Feed, error) {
 		&i.Name,
 		&i.Url,
 		&i.LastFetchedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.LastError,
+		&i.FailureCount,
+		&i.LastSuccessAt,
+		&i.Disabled,
+		&i.NextFetchAt,
+		&i.FetchIntervalSeconds,
+		&i.Description,
+		&i.SiteUrl,
+		&i.Language,
+		&i.ImageUrl,
+		&i.FetchFullContent,
+		&i.LeasedUntil,
 	)
 	return i, err
 }
 
-const markFeedFetched = `-- name: MarkFeedFetched :exec
+const updateFeedCacheHeaders = `-- name: UpdateFeedCacheHeaders :exec
 UPDATE feeds
 SET
 updated_at = NOW(),
-last_fetched_at = NOW()
+etag = $2,
+last_modified = $3
 WHERE id = $1
 `
 
-func (q *Queries) MarkFeedFetched(ctx context.Context, id uuid.UUID) error {
-	_, err := q.db.ExecContext(ctx, markFeedFetched, id)
+type UpdateFeedCacheHeadersParams struct {
+	ID           uuid.UUID
+	Etag         sql.NullString
+	LastModified sql.NullString
+}
+
+func (q *Queries) UpdateFeedCacheHeaders(ctx context.Context, arg UpdateFeedCacheHeadersParams) error {
+	_, err := q.db.ExecContext(ctx, updateFeedCacheHeaders, arg.ID, arg.Etag, arg.LastModified)
+	return err
+}
+
+const updateFeedMetadata = `-- name: UpdateFeedMetadata :exec
+UPDATE feeds
+SET
+updated_at = NOW(),
+description = $2,
+site_url = $3,
+language = $4,
+image_url = $5
+WHERE id = $1
+`
+
+type UpdateFeedMetadataParams struct {
+	ID          uuid.UUID
+	Description sql.NullString
+	SiteUrl     sql.NullString
+	Language    sql.NullString
+	ImageUrl    sql.NullString
+}
+
+func (q *Queries) UpdateFeedMetadata(ctx context.Context, arg UpdateFeedMetadataParams) error {
+	_, err := q.db.ExecContext(ctx, updateFeedMetadata,
+		arg.ID,
+		arg.Description,
+		arg.SiteUrl,
+		arg.Language,
+		arg.ImageUrl,
+	)
 	return err
 }
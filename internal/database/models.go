@@ -11,14 +11,38 @@ import (
 	"github.com/google/uuid"
 )
 
-type Feed struct {
-	ID            uuid.UUID
+type ContentFetch struct {
+	PostID        uuid.UUID
 	CreatedAt     time.Time
 	UpdatedAt     time.Time
-	UserID        uuid.UUID
-	Name          string
-	Url           string
-	LastFetchedAt sql.NullTime
+	Attempts      int32
+	NextAttemptAt time.Time
+	LastError     sql.NullString
+	FetchedAt     sql.NullTime
+}
+
+type Feed struct {
+	ID                   uuid.UUID
+	CreatedAt            time.Time
+	UpdatedAt            time.Time
+	UserID               uuid.UUID
+	Name                 string
+	Url                  string
+	LastFetchedAt        sql.NullTime
+	Etag                 sql.NullString
+	LastModified         sql.NullString
+	LastError            sql.NullString
+	FailureCount         int32
+	LastSuccessAt        sql.NullTime
+	Disabled             bool
+	NextFetchAt          sql.NullTime
+	FetchIntervalSeconds int32
+	Description          sql.NullString
+	SiteUrl              sql.NullString
+	Language             sql.NullString
+	ImageUrl             sql.NullString
+	FetchFullContent     bool
+	LeasedUntil          sql.NullTime
 }
 
 type FeedFollow struct {
@@ -29,20 +53,124 @@ type FeedFollow struct {
 	FeedID    uuid.UUID
 }
 
+type FeedFollowTag struct {
+	FeedFollowID uuid.UUID
+	TagID        uuid.UUID
+	CreatedAt    time.Time
+}
+
+type FilterRule struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	UserID    uuid.UUID
+	Field     string
+	Pattern   string
+	IsRegex   bool
+	Action    string
+	Tag       sql.NullString
+}
+
 type Post struct {
-	ID          uuid.UUID
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
-	Title       string
-	Url         string
-	Description sql.NullString
-	PublishedAt time.Time
-	FeedID      uuid.UUID
+	ID           uuid.UUID
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	Title        string
+	Url          string
+	Description  sql.NullString
+	PublishedAt  time.Time
+	FeedID       uuid.UUID
+	SearchVector interface{}
+	Guid         string
+	Content      sql.NullString
+	Author       sql.NullString
+	CommentsUrl  sql.NullString
 }
 
-type User struct {
+type PostCategory struct {
+	PostID    uuid.UUID
+	Name      string
+	CreatedAt time.Time
+}
+
+type PostEnclosure struct {
 	ID        uuid.UUID
 	CreatedAt time.Time
 	UpdatedAt time.Time
+	PostID    uuid.UUID
+	Url       string
+	MimeType  sql.NullString
+	Length    sql.NullInt64
+}
+
+type PostState struct {
+	UserID    uuid.UUID
+	PostID    uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	ReadAt    sql.NullTime
+	StarredAt sql.NullTime
+	HiddenAt  sql.NullTime
+}
+
+type PostTag struct {
+	UserID    uuid.UUID
+	PostID    uuid.UUID
+	Tag       string
+	CreatedAt time.Time
+}
+
+type Tag struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	UserID    uuid.UUID
 	Name      string
 }
+
+type User struct {
+	ID           uuid.UUID
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	Name         string
+	ApiKey       string
+	FeedToken    string
+	Email        sql.NullString
+	LastDigestAt sql.NullTime
+}
+
+type Webhook struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	UserID    uuid.UUID
+	FeedID    uuid.NullUUID
+	Keyword   sql.NullString
+	Url       string
+	Secret    string
+}
+
+type WebhookDelivery struct {
+	ID            uuid.UUID
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	WebhookID     uuid.UUID
+	PostID        uuid.UUID
+	Attempts      int32
+	NextAttemptAt time.Time
+	StatusCode    sql.NullInt32
+	LastError     sql.NullString
+	DeliveredAt   sql.NullTime
+}
+
+type WebsubSubscription struct {
+	ID             uuid.UUID
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	FeedID         uuid.UUID
+	HubUrl         string
+	TopicUrl       string
+	Secret         string
+	RequestedAt    sql.NullTime
+	LeaseExpiresAt sql.NullTime
+}
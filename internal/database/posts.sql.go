@@ -13,43 +13,146 @@ import (
 	"github.com/google/uuid"
 )
 
-const createPost = `-- name: CreatePost :one
-INSERT INTO posts (id, created_at, updated_at, title, url, description, published_at, feed_id)
-VALUES (
-    $1,
-    $2,
-    $3,
-    $4,
-    $5,
-    $6,
-    $7,
-    $8
+const getDigestPostsForUser = `-- name: GetDigestPostsForUser :many
+SELECT p.id, p.created_at, p.updated_at, p.title, p.url, p.description, p.published_at, p.feed_id, p.search_vector, p.guid, p.content, p.author, p.comments_url, f.name AS feed_name
+FROM posts p
+INNER JOIN feed_follows ff ON ff.feed_id = p.feed_id
+INNER JOIN feeds f ON f.id = p.feed_id
+WHERE ff.user_id = $1
+AND p.created_at > $2
+AND p.created_at <= $3
+AND NOT EXISTS (
+    SELECT 1
+    FROM post_states ps
+    WHERE ps.user_id = ff.user_id AND ps.post_id = p.id AND ps.hidden_at IS NOT NULL
 )
-RETURNING id, created_at, updated_at, title, url, description, published_at, feed_id
+ORDER BY f.name, p.published_at DESC
 `
 
-type CreatePostParams struct {
-	ID          uuid.UUID
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
-	Title       string
-	Url         string
-	Description sql.NullString
-	PublishedAt time.Time
-	FeedID      uuid.UUID
+type GetDigestPostsForUserParams struct {
+	UserID uuid.UUID
+	Since  time.Time
+	Until  time.Time
 }
 
-func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) (Post, error) {
-	row := q.db.QueryRowContext(ctx, createPost,
-		arg.ID,
-		arg.CreatedAt,
-		arg.UpdatedAt,
-		arg.Title,
-		arg.Url,
-		arg.Description,
-		arg.PublishedAt,
-		arg.FeedID,
-	)
+type GetDigestPostsForUserRow struct {
+	ID           uuid.UUID
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	Title        string
+	Url          string
+	Description  sql.NullString
+	PublishedAt  time.Time
+	FeedID       uuid.UUID
+	SearchVector interface{}
+	Guid         string
+	Content      sql.NullString
+	Author       sql.NullString
+	CommentsUrl  sql.NullString
+	FeedName     string
+}
+
+func (q *Queries) GetDigestPostsForUser(ctx context.Context, arg GetDigestPostsForUserParams) ([]GetDigestPostsForUserRow, error) {
+	rows, err := q.db.QueryContext(ctx, getDigestPostsForUser, arg.UserID, arg.Since, arg.Until)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetDigestPostsForUserRow
+	for rows.Next() {
+		var i GetDigestPostsForUserRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Title,
+			&i.Url,
+			&i.Description,
+			&i.PublishedAt,
+			&i.FeedID,
+			&i.SearchVector,
+			&i.Guid,
+			&i.Content,
+			&i.Author,
+			&i.CommentsUrl,
+			&i.FeedName,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getFollowedPostsForUser = `-- name: GetFollowedPostsForUser :many
+SELECT p.id, p.created_at, p.updated_at, p.title, p.url, p.description, p.published_at, p.feed_id, p.search_vector, p.guid, p.content, p.author, p.comments_url
+FROM posts p
+INNER JOIN feed_follows ff ON ff.feed_id = p.feed_id
+WHERE ff.user_id = $1
+ORDER BY p.published_at DESC
+`
+
+func (q *Queries) GetFollowedPostsForUser(ctx context.Context, userID uuid.UUID) ([]Post, error) {
+	rows, err := q.db.QueryContext(ctx, getFollowedPostsForUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Post
+	for rows.Next() {
+		var i Post
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Title,
+			&i.Url,
+			&i.Description,
+			&i.PublishedAt,
+			&i.FeedID,
+			&i.SearchVector,
+			&i.Guid,
+			&i.Content,
+			&i.Author,
+			&i.CommentsUrl,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getPostForUser = `-- name: GetPostForUser :one
+SELECT id, created_at, updated_at, title, url, description, published_at, feed_id, search_vector, guid, content, author, comments_url
+FROM posts
+WHERE posts.id = $1
+AND EXISTS (
+    SELECT 1
+    FROM feed_follows ff
+    WHERE ff.feed_id = posts.feed_id AND ff.user_id = $2
+)
+`
+
+type GetPostForUserParams struct {
+	ID     uuid.UUID
+	UserID uuid.UUID
+}
+
+func (q *Queries) GetPostForUser(ctx context.Context, arg GetPostForUserParams) (Post, error) {
+	row := q.db.QueryRowContext(ctx, getPostForUser, arg.ID, arg.UserID)
 	var i Post
 	err := row.Scan(
 		&i.ID,
@@ -60,33 +163,98 @@ func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) (Post, e
 		&i.Description,
 		&i.PublishedAt,
 		&i.FeedID,
+		&i.SearchVector,
+		&i.Guid,
+		&i.Content,
+		&i.Author,
+		&i.CommentsUrl,
 	)
 	return i, err
 }
 
-const getPostsForUser = `-- name: GetPostsForUser :many
-SELECT p.id, p.created_at, p.updated_at, p.title, p.url, p.description, p.published_at, p.feed_id
+const getTimelineForUser = `-- name: GetTimelineForUser :many
+SELECT p.id, p.created_at, p.updated_at, p.title, p.url, p.description, p.published_at, p.feed_id, p.search_vector, p.guid, p.content, p.author, p.comments_url, f.name AS feed_name, f.url AS feed_url, ps.read_at, ps.starred_at
 FROM posts p
-JOIN feeds f ON p.feed_id = f.id
-WHERE f.user_id = $1
-ORDER BY p.published_at DESC
-LIMIT $2
+INNER JOIN feed_follows ff ON ff.feed_id = p.feed_id
+INNER JOIN feeds f ON f.id = p.feed_id
+LEFT JOIN post_states ps ON ps.post_id = p.id AND ps.user_id = ff.user_id
+WHERE ff.user_id = $1
+AND ($2::text IS NULL OR f.url = $2::text)
+AND ($3::text IS NULL OR EXISTS (
+    SELECT 1
+    FROM feed_follow_tags fft
+    INNER JOIN tags t ON t.id = fft.tag_id
+    WHERE fft.feed_follow_id = ff.id AND t.name = $3::text
+))
+AND ($4::timestamp IS NULL OR p.published_at >= $4::timestamp)
+AND ($5::timestamp IS NULL OR p.published_at < $5::timestamp)
+AND (NOT $6::boolean OR ps.read_at IS NULL)
+AND ps.hidden_at IS NULL
+AND ($7::uuid IS NULL OR (p.published_at, p.id) < (
+    SELECT ap.published_at, ap.id
+    FROM posts ap
+    WHERE ap.id = $7::uuid
+))
+AND ($8::text IS NULL OR EXISTS (
+    SELECT 1
+    FROM post_tags pt
+    WHERE pt.user_id = ff.user_id AND pt.post_id = p.id AND pt.tag = $8::text
+))
+ORDER BY p.published_at DESC, p.id DESC
+LIMIT $9
 `
 
-type GetPostsForUserParams struct {
-	UserID uuid.UUID
-	Limit  int32
+type GetTimelineForUserParams struct {
+	UserID     uuid.UUID
+	FeedUrl    sql.NullString
+	Tag        sql.NullString
+	Since      sql.NullTime
+	Until      sql.NullTime
+	UnreadOnly bool
+	After      uuid.NullUUID
+	PostTag    sql.NullString
+	MaxPosts   int32
 }
 
-func (q *Queries) GetPostsForUser(ctx context.Context, arg GetPostsForUserParams) ([]Post, error) {
-	rows, err := q.db.QueryContext(ctx, getPostsForUser, arg.UserID, arg.Limit)
+type GetTimelineForUserRow struct {
+	ID           uuid.UUID
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	Title        string
+	Url          string
+	Description  sql.NullString
+	PublishedAt  time.Time
+	FeedID       uuid.UUID
+	SearchVector interface{}
+	Guid         string
+	Content      sql.NullString
+	Author       sql.NullString
+	CommentsUrl  sql.NullString
+	FeedName     string
+	FeedUrl      string
+	ReadAt       sql.NullTime
+	StarredAt    sql.NullTime
+}
+
+func (q *Queries) GetTimelineForUser(ctx context.Context, arg GetTimelineForUserParams) ([]GetTimelineForUserRow, error) {
+	rows, err := q.db.QueryContext(ctx, getTimelineForUser,
+		arg.UserID,
+		arg.FeedUrl,
+		arg.Tag,
+		arg.Since,
+		arg.Until,
+		arg.UnreadOnly,
+		arg.After,
+		arg.PostTag,
+		arg.MaxPosts,
+	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []Post
+	var items []GetTimelineForUserRow
 	for rows.Next() {
-		var i Post
+		var i GetTimelineForUserRow
 		if err := rows.Scan(
 			&i.ID,
 			&i.CreatedAt,
@@ -96,6 +264,15 @@ func (q *Queries) GetPostsForUser(ctx context.Context, arg GetPostsForUserParams
 			&i.Description,
 			&i.PublishedAt,
 			&i.FeedID,
+			&i.SearchVector,
+			&i.Guid,
+			&i.Content,
+			&i.Author,
+			&i.CommentsUrl,
+			&i.FeedName,
+			&i.FeedUrl,
+			&i.ReadAt,
+			&i.StarredAt,
 		); err != nil {
 			return nil, err
 		}
@@ -109,3 +286,201 @@ func (q *Queries) GetPostsForUser(ctx context.Context, arg GetPostsForUserParams
 	}
 	return items, nil
 }
+
+const searchPostsForUser = `-- name: SearchPostsForUser :many
+SELECT p.id, p.title, p.url, p.published_at, p.author, f.name AS feed_name,
+    ts_rank(p.search_vector, query)::real AS rank,
+    ts_headline(
+        'english',
+        p.title || ' ' || coalesce(p.description, ''),
+        query,
+        'StartSel=**, StopSel=**, MaxFragments=2, MaxWords=20, MinWords=8'
+    )::text AS snippet
+FROM posts p
+INNER JOIN feed_follows ff ON ff.feed_id = p.feed_id
+INNER JOIN feeds f ON f.id = p.feed_id
+CROSS JOIN websearch_to_tsquery('english', $1::text) query
+WHERE ff.user_id = $2
+AND p.search_vector @@ query
+AND NOT EXISTS (
+    SELECT 1
+    FROM post_states ps
+    WHERE ps.user_id = ff.user_id AND ps.post_id = p.id AND ps.hidden_at IS NOT NULL
+)
+AND ($3::text IS NULL OR f.url = $3::text)
+AND ($4::timestamp IS NULL OR p.published_at >= $4::timestamp)
+AND ($5::timestamp IS NULL OR p.published_at < $5::timestamp)
+AND ($6::text IS NULL OR p.author ILIKE '%' || $6::text || '%')
+AND ($7::text IS NULL OR EXISTS (
+    SELECT 1
+    FROM post_categories pc
+    WHERE pc.post_id = p.id AND lower(pc.name) = lower($7::text)
+))
+AND ($8::text IS NULL OR EXISTS (
+    SELECT 1
+    FROM post_tags pt
+    WHERE pt.user_id = ff.user_id AND pt.post_id = p.id AND pt.tag = $8::text
+))
+ORDER BY rank DESC, p.published_at DESC
+LIMIT $9
+`
+
+type SearchPostsForUserParams struct {
+	Query      string
+	UserID     uuid.UUID
+	FeedUrl    sql.NullString
+	Since      sql.NullTime
+	Until      sql.NullTime
+	Author     sql.NullString
+	Category   sql.NullString
+	PostTag    sql.NullString
+	MaxResults int32
+}
+
+type SearchPostsForUserRow struct {
+	ID          uuid.UUID
+	Title       string
+	Url         string
+	PublishedAt time.Time
+	Author      sql.NullString
+	FeedName    string
+	Rank        float32
+	Snippet     string
+}
+
+func (q *Queries) SearchPostsForUser(ctx context.Context, arg SearchPostsForUserParams) ([]SearchPostsForUserRow, error) {
+	rows, err := q.db.QueryContext(ctx, searchPostsForUser,
+		arg.Query,
+		arg.UserID,
+		arg.FeedUrl,
+		arg.Since,
+		arg.Until,
+		arg.Author,
+		arg.Category,
+		arg.PostTag,
+		arg.MaxResults,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SearchPostsForUserRow
+	for rows.Next() {
+		var i SearchPostsForUserRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Title,
+			&i.Url,
+			&i.PublishedAt,
+			&i.Author,
+			&i.FeedName,
+			&i.Rank,
+			&i.Snippet,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const upsertPost = `-- name: UpsertPost :one
+INSERT INTO posts (id, created_at, updated_at, title, url, description, published_at, feed_id, guid, content, author, comments_url)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7,
+    $8,
+    $9,
+    $10,
+    $11,
+    $12
+)
+ON CONFLICT (feed_id, guid) DO UPDATE
+SET
+updated_at = EXCLUDED.updated_at,
+title = EXCLUDED.title,
+url = EXCLUDED.url,
+description = EXCLUDED.description,
+content = COALESCE(EXCLUDED.content, posts.content),
+author = EXCLUDED.author,
+comments_url = EXCLUDED.comments_url
+RETURNING id, created_at, updated_at, title, url, description, published_at, feed_id, search_vector, guid, content, author, comments_url, (xmax = 0) AS inserted
+`
+
+type UpsertPostParams struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Title       string
+	Url         string
+	Description sql.NullString
+	PublishedAt time.Time
+	FeedID      uuid.UUID
+	Guid        string
+	Content     sql.NullString
+	Author      sql.NullString
+	CommentsUrl sql.NullString
+}
+
+type UpsertPostRow struct {
+	ID           uuid.UUID
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	Title        string
+	Url          string
+	Description  sql.NullString
+	PublishedAt  time.Time
+	FeedID       uuid.UUID
+	SearchVector interface{}
+	Guid         string
+	Content      sql.NullString
+	Author       sql.NullString
+	CommentsUrl  sql.NullString
+	Inserted     bool
+}
+
+func (q *Queries) UpsertPost(ctx context.Context, arg UpsertPostParams) (UpsertPostRow, error) {
+	row := q.db.QueryRowContext(ctx, upsertPost,
+		arg.ID,
+		arg.CreatedAt,
+		arg.UpdatedAt,
+		arg.Title,
+		arg.Url,
+		arg.Description,
+		arg.PublishedAt,
+		arg.FeedID,
+		arg.Guid,
+		arg.Content,
+		arg.Author,
+		arg.CommentsUrl,
+	)
+	var i UpsertPostRow
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Title,
+		&i.Url,
+		&i.Description,
+		&i.PublishedAt,
+		&i.FeedID,
+		&i.SearchVector,
+		&i.Guid,
+		&i.Content,
+		&i.Author,
+		&i.CommentsUrl,
+		&i.Inserted,
+	)
+	return i, err
+}
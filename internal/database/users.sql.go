@@ -7,20 +7,23 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
 )
 
 const createUser = `-- name: CreateUser :one
-INSERT INTO users (id, created_at, updated_at, name)
+INSERT INTO users (id, created_at, updated_at, name, api_key, feed_token)
 VALUES (
     $1,
     $2,
     $3,
-    $4
+    $4,
+    $5,
+    $6
 )
-RETURNING id, created_at, updated_at, name
+RETURNING id, created_at, updated_at, name, api_key, feed_token, email, last_digest_at
 `
 
 type CreateUserParams struct {
@@ -28,6 +31,8 @@ type CreateUserParams struct {
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	Name      string
+	ApiKey    string
+	FeedToken string
 }
 
 func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, error) {
@@ -36,6 +41,8 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		arg.CreatedAt,
 		arg.UpdatedAt,
 		arg.Name,
+		arg.ApiKey,
+		arg.FeedToken,
 	)
 	var i User
 	err := row.Scan(
@@ -43,12 +50,16 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.Name,
+		&i.ApiKey,
+		&i.FeedToken,
+		&i.Email,
+		&i.LastDigestAt,
 	)
 	return i, err
 }
 
 const getUser = `-- name: GetUser :one
-SELECT id, created_at, updated_at, name
+SELECT id, created_at, updated_at, name, api_key, feed_token, email, last_digest_at
 FROM users
 WHERE users.name = $1
 LIMIT 1
@@ -62,12 +73,62 @@ func (q *Queries) GetUser(ctx context.Context, name string) (User, error) {
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.Name,
+		&i.ApiKey,
+		&i.FeedToken,
+		&i.Email,
+		&i.LastDigestAt,
+	)
+	return i, err
+}
+
+const getUserByAPIKey = `-- name: GetUserByAPIKey :one
+SELECT id, created_at, updated_at, name, api_key, feed_token, email, last_digest_at
+FROM users
+WHERE users.api_key = $1
+LIMIT 1
+`
+
+func (q *Queries) GetUserByAPIKey(ctx context.Context, apiKey string) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByAPIKey, apiKey)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.ApiKey,
+		&i.FeedToken,
+		&i.Email,
+		&i.LastDigestAt,
+	)
+	return i, err
+}
+
+const getUserByFeedToken = `-- name: GetUserByFeedToken :one
+SELECT id, created_at, updated_at, name, api_key, feed_token, email, last_digest_at
+FROM users
+WHERE users.feed_token = $1
+LIMIT 1
+`
+
+func (q *Queries) GetUserByFeedToken(ctx context.Context, feedToken string) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByFeedToken, feedToken)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.ApiKey,
+		&i.FeedToken,
+		&i.Email,
+		&i.LastDigestAt,
 	)
 	return i, err
 }
 
 const getUserById = `-- name: GetUserById :one
-SELECT id, created_at, updated_at, name
+SELECT id, created_at, updated_at, name, api_key, feed_token, email, last_digest_at
 FROM users
 WHERE users.id = $1
 LIMIT 1
@@ -81,12 +142,16 @@ func (q *Queries) GetUserById(ctx context.Context, id uuid.UUID) (User, error) {
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.Name,
+		&i.ApiKey,
+		&i.FeedToken,
+		&i.Email,
+		&i.LastDigestAt,
 	)
 	return i, err
 }
 
 const getUsers = `-- name: GetUsers :many
-SELECT id, created_at, updated_at, name
+SELECT id, created_at, updated_at, name, api_key, feed_token, email, last_digest_at
 FROM users
 `
 
@@ -104,6 +169,10 @@ func (q *Queries) GetUsers(ctx context.Context) ([]User, error) {
 			&i.CreatedAt,
 			&i.UpdatedAt,
 			&i.Name,
+			&i.ApiKey,
+			&i.FeedToken,
+			&i.Email,
+			&i.LastDigestAt,
 		); err != nil {
 			return nil, err
 		}
@@ -118,6 +187,61 @@ func (q *Queries) GetUsers(ctx context.Context) ([]User, error) {
 	return items, nil
 }
 
+const getUsersDueForDigest = `-- name: GetUsersDueForDigest :many
+SELECT id, created_at, updated_at, name, api_key, feed_token, email, last_digest_at
+FROM users
+WHERE users.email IS NOT NULL
+AND (users.last_digest_at IS NULL OR users.last_digest_at <= $1)
+`
+
+func (q *Queries) GetUsersDueForDigest(ctx context.Context, lastDigestAt sql.NullTime) ([]User, error) {
+	rows, err := q.db.QueryContext(ctx, getUsersDueForDigest, lastDigestAt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Name,
+			&i.ApiKey,
+			&i.FeedToken,
+			&i.Email,
+			&i.LastDigestAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markDigestSent = `-- name: MarkDigestSent :exec
+UPDATE users
+SET last_digest_at = $2, updated_at = $2
+WHERE users.id = $1
+`
+
+type MarkDigestSentParams struct {
+	ID           uuid.UUID
+	LastDigestAt sql.NullTime
+}
+
+func (q *Queries) MarkDigestSent(ctx context.Context, arg MarkDigestSentParams) error {
+	_, err := q.db.ExecContext(ctx, markDigestSent, arg.ID, arg.LastDigestAt)
+	return err
+}
+
 const resetUsers = `-- name: ResetUsers :exec
 DELETE FROM users
 `
@@ -126,3 +250,19 @@ func (q *Queries) ResetUsers(ctx context.Context) error {
 	_, err := q.db.ExecContext(ctx, resetUsers)
 	return err
 }
+
+const setUserEmail = `-- name: SetUserEmail :exec
+UPDATE users
+SET email = $2, updated_at = NOW()
+WHERE users.id = $1
+`
+
+type SetUserEmailParams struct {
+	ID    uuid.UUID
+	Email sql.NullString
+}
+
+func (q *Queries) SetUserEmail(ctx context.Context, arg SetUserEmailParams) error {
+	_, err := q.db.ExecContext(ctx, setUserEmail, arg.ID, arg.Email)
+	return err
+}
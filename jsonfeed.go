@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"strconv"
+	"strings"
+)
+
+type JSONFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url"`
+	Description string         `json:"description"`
+	Language    string         `json:"language"`
+	Icon        string         `json:"icon"`
+	Favicon     string         `json:"favicon"`
+	Items       []JSONFeedItem `json:"items"`
+}
+
+type JSONFeedAuthor struct {
+	Name string `json:"name"`
+}
+
+type JSONFeedAttachment struct {
+	URL         string `json:"url"`
+	MimeType    string `json:"mime_type"`
+	SizeInBytes int64  `json:"size_in_bytes"`
+}
+
+type JSONFeedItem struct {
+	ID            json.RawMessage      `json:"id"`
+	URL           string               `json:"url"`
+	Title         string               `json:"title"`
+	ContentHTML   string               `json:"content_html"`
+	ContentText   string               `json:"content_text"`
+	Summary       string               `json:"summary"`
+	DatePublished string               `json:"date_published"`
+	DateModified  string               `json:"date_modified"`
+	Authors       []JSONFeedAuthor     `json:"authors"`
+	Author        *JSONFeedAuthor      `json:"author"`
+	Tags          []string             `json:"tags"`
+	Attachments   []JSONFeedAttachment `json:"attachments"`
+}
+
+// isJSONFeed reports whether a response is a JSON Feed, either from its
+// content type or, since many servers send text/plain, from the body.
+func isJSONFeed(contentType string, data []byte) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err == nil && (mediaType == "application/feed+json" || mediaType == "application/json") {
+		return true
+	}
+
+	trimmed := bytes.TrimSpace(data)
+	return len(trimmed) > 0 && trimmed[0] == '{'
+}
+
+// itemID returns the item id as a string. The spec says it is a string, but
+// older feeds publish numbers.
+func (item JSONFeedItem) itemID() string {
+	var id string
+	if err := json.Unmarshal(item.ID, &id); err == nil {
+		return id
+	}
+	return string(item.ID)
+}
+
+func (item JSONFeedItem) authorNames() string {
+	authors := item.Authors
+	if len(authors) == 0 && item.Author != nil {
+		authors = []JSONFeedAuthor{*item.Author}
+	}
+
+	names := []string{}
+	for _, author := range authors {
+		if author.Name != "" {
+			names = append(names, author.Name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// toRSS maps the JSON Feed onto RSSFeed so that scrapeFeeds can handle it
+// with the same post creation code.
+func (j JSONFeed) toRSS() *RSSFeed {
+	rssFeed := RSSFeed{}
+	rssFeed.Channel.Title = j.Title
+	rssFeed.Channel.Link = j.HomePageURL
+	rssFeed.Channel.Description = j.Description
+	rssFeed.Channel.Language = j.Language
+	rssFeed.Channel.ImageURL = j.Icon
+	if rssFeed.Channel.ImageURL == "" {
+		rssFeed.Channel.ImageURL = j.Favicon
+	}
+
+	for _, item := range j.Items {
+		description := item.Summary
+		if description == "" {
+			description = item.ContentHTML
+		}
+		if description == "" {
+			description = item.ContentText
+		}
+
+		enclosures := []RSSEnclosure{}
+		for _, attachment := range item.Attachments {
+			enclosure := RSSEnclosure{URL: attachment.URL, Type: attachment.MimeType}
+			if attachment.SizeInBytes > 0 {
+				enclosure.Length = strconv.FormatInt(attachment.SizeInBytes, 10)
+			}
+			enclosures = append(enclosures, enclosure)
+		}
+
+		date := item.DatePublished
+		if date == "" {
+			date = item.DateModified
+		}
+
+		rssFeed.Channel.Item = append(rssFeed.Channel.Item, RSSItem{
+			Title:       item.Title,
+			Link:        item.URL,
+			Description: description,
+			PubDate:     date,
+			GUID:        item.itemID(),
+			Content:     item.ContentHTML,
+			Author:      item.authorNames(),
+			Categories:  item.Tags,
+			Enclosures:  enclosures,
+		})
+	}
+
+	return &rssFeed
+}
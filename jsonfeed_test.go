@@ -0,0 +1,61 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestJSONFeedToRSS(t *testing.T) {
+	// Servers often send JSON Feeds as text/plain.
+	feed, err := parseFeed("text/plain", []byte(readFixture(t, "jsonfeed.json")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	channel := feed.Channel
+	if channel.Title != "JSON Example" || channel.Link != "https://example.com/" || channel.Language != "en" {
+		t.Errorf("unexpected channel %q, %q, %q", channel.Title, channel.Link, channel.Language)
+	}
+	if channel.ImageURL != "https://example.com/favicon.ico" {
+		t.Errorf("channel image is %q", channel.ImageURL)
+	}
+
+	want := []RSSItem{
+		{
+			Title:       "Numeric id",
+			Link:        "https://example.com/numeric",
+			Description: "<p>Some <em>html</em></p>",
+			Content:     "<p>Some <em>html</em></p>",
+			PubDate:     "2024-03-02T10:00:00Z",
+			GUID:        "42",
+			Author:      "Jane, John",
+			Categories:  []string{"food", "recipes"},
+			Enclosures:  []RSSEnclosure{{URL: "https://example.com/numeric.mp3", Type: "audio/mpeg", Length: "1234"}},
+		},
+		{
+			Title:       "Text only",
+			Link:        "https://example.com/text",
+			Description: "Only text",
+			PubDate:     "2024-03-01T10:00:00Z",
+			GUID:        "https://example.com/text",
+			Author:      "Legacy Author",
+			Enclosures:  []RSSEnclosure{},
+		},
+		{
+			Title:       "With a summary",
+			Description: "Short summary",
+			Content:     "<p>Long content</p>",
+			GUID:        "summary",
+			Enclosures:  []RSSEnclosure{},
+		},
+	}
+
+	if len(channel.Item) != len(want) {
+		t.Fatalf("expected %d items, got %d", len(want), len(channel.Item))
+	}
+	for i := range want {
+		if !reflect.DeepEqual(channel.Item[i], want[i]) {
+			t.Errorf("item %d:\n got %#v\nwant %#v", i, channel.Item[i], want[i])
+		}
+	}
+}
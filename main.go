@@ -1,23 +1,31 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
+	"encoding/json"
 	"encoding/xml"
 	"errors"
+	"flag"
 	"fmt"
 	"html"
 	"io"
+	"maps"
 	"net/http"
 	"os"
+	"os/signal"
+	"slices"
 	"strconv"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/alpsilva/config"
 	"github.com/alpsilva/go-blog-aggregator.git/internal/database"
 	"github.com/google/uuid"
 
-	"github.com/lib/pq"
 	_ "github.com/lib/pq"
 )
 
@@ -51,24 +59,81 @@ func (c commands) run(s *state, cmd command) error {
 
 type RSSFeed struct {
 	Channel struct {
-		Title       string    `xml:"title"`
-		Link        string    `xml:"link"`
-		Description string    `xml:"description"`
-		Item        []RSSItem `xml:"item"`
+		// AtomLinks must come before Link, otherwise the decoder stores
+		// <atom:link> elements in Link as well.
+		AtomLinks       []AtomLink `xml:"http://www.w3.org/2005/Atom link"`
+		Title           string     `xml:"title"`
+		Link            string     `xml:"link"`
+		Description     string     `xml:"description"`
+		TTL             int        `xml:"ttl"`
+		UpdatePeriod    string     `xml:"http://purl.org/rss/1.0/modules/syndication/ updatePeriod"`
+		UpdateFrequency int        `xml:"http://purl.org/rss/1.0/modules/syndication/ updateFrequency"`
+		SkipHours       []int      `xml:"skipHours>hour"`
+		SkipDays        []string   `xml:"skipDays>day"`
+		Language        string     `xml:"language"`
+		ImageURL        string     `xml:"image>url"`
+		Item            []RSSItem  `xml:"item"`
 	} `xml:"channel"`
 }
 
 type RSSItem struct {
-	Title       string `xml:"title"`
-	Link        string `xml:"link"`
-	Description string `xml:"description"`
-	PubDate     string `xml:"pubDate"`
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	Description string   `xml:"description"`
+	Content     string   `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	PubDate     string   `xml:"pubDate"`
+	GUID        string   `xml:"guid"`
+	Author      string   `xml:"author"`
+	Creator     string   `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	Categories  []string `xml:"category"`
+	// CommentCount must come before Comments, otherwise the decoder
+	// stores <slash:comments> counts in Comments as well.
+	CommentCount string         `xml:"http://purl.org/rss/1.0/modules/slash/ comments"`
+	Comments     string         `xml:"comments"`
+	Enclosures   []RSSEnclosure `xml:"enclosure"`
+}
+
+// RSSEnclosure is a file attached to an item, like a podcast episode.
+// Length is kept as text since feeds often publish it empty or invalid.
+type RSSEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Type   string `xml:"type,attr"`
+	Length string `xml:"length,attr"`
+}
+
+// author is the author of the item, from <author> or <dc:creator>.
+func (item RSSItem) author() string {
+	if item.Author != "" {
+		return strings.TrimSpace(item.Author)
+	}
+	return strings.TrimSpace(item.Creator)
 }
 
 func (c commands) register(name string, f func(*state, command) error) {
 	c.availableCommands[name] = f
 }
 
+// parseArgs parses the flags registered on fs and returns the remaining
+// positional arguments. Unlike fs.Parse it accepts flags after positional
+// arguments, so "browse 10 --unread" works as well as "browse --unread 10".
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	positional := []string{}
+	for {
+		err := fs.Parse(args)
+		if err != nil {
+			return nil, err
+		}
+
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
 func handlerLogin(s *state, cmd command) error {
 	if len(cmd.args) == 0 {
 		return errors.New("no username provided")
@@ -101,11 +166,22 @@ func handlerRegister(s *state, cmd command) error {
 		return errors.New("user already exists")
 	}
 
+	apiKey, err := newToken()
+	if err != nil {
+		return err
+	}
+	feedToken, err := newToken()
+	if err != nil {
+		return err
+	}
+
 	params := database.CreateUserParams{
 		ID:        uuid.New(),
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 		Name:      cmd.args[0],
+		ApiKey:    apiKey,
+		FeedToken: feedToken,
 	}
 
 	newUser, err := s.db.CreateUser(context.Background(), params)
@@ -158,35 +234,72 @@ func handlerListUsers(s *state, cmd command) error {
 	return nil
 }
 
-func handlerAddFeed(s *state, cmd command, user database.User) error {
-
-	if len(cmd.args) < 2 {
-		return errors.New("not enough arguments. needs name and url")
-	}
-
+// addFeedForUser creates a feed owned by user and follows it on their
+// behalf.
+func addFeedForUser(ctx context.Context, db *database.Queries, user database.User, name string, url string) (database.Feed, error) {
 	params := database.CreateFeedParams{
 		ID:        uuid.New(),
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 		UserID:    user.ID,
-		Name:      cmd.args[0],
-		Url:       cmd.args[1],
+		Name:      name,
+		Url:       url,
 	}
 
-	newFeed, err := s.db.CreateFeed(context.Background(), params)
+	newFeed, err := db.CreateFeed(ctx, params)
 	if err != nil {
-		return err
+		return database.Feed{}, err
+	}
+
+	_, err = followFeed(ctx, db, user, newFeed.ID)
+	if err != nil {
+		return database.Feed{}, err
 	}
 
-	followParams := database.CreateFeedFollowParams{
+	return newFeed, nil
+}
+
+func followFeed(ctx context.Context, db *database.Queries, user database.User, feedID uuid.UUID) (database.CreateFeedFollowRow, error) {
+	params := database.CreateFeedFollowParams{
 		ID:        uuid.New(),
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 		UserID:    user.ID,
-		FeedID:    newFeed.ID,
+		FeedID:    feedID,
+	}
+
+	return db.CreateFeedFollow(ctx, params)
+}
+
+func handlerAddFeed(s *state, cmd command, user database.User) error {
+	fs := flag.NewFlagSet("addfeed", flag.ContinueOnError)
+	force := fs.Bool("force", false, "add the url even if it does not serve a valid feed")
+	args, err := parseArgs(fs, cmd.args)
+	if err != nil {
+		return err
+	}
+
+	if len(args) < 1 {
+		return errors.New("not enough arguments. needs url and optionally a name before it")
+	}
+
+	name, rawURL := "", args[0]
+	if len(args) > 1 {
+		name, rawURL = args[0], args[1]
+	}
+
+	feedURL, rssFeed, err := validateFeedURL(context.Background(), rawURL)
+	if err != nil {
+		if !*force {
+			return fmt.Errorf("%s is not a valid feed (%w). use --force to add it anyway", rawURL, err)
+		}
+		fmt.Printf("Adding %s without validation: %s\n", rawURL, err)
+		feedURL, rssFeed = rawURL, &RSSFeed{}
+	} else if feedURL != rawURL {
+		fmt.Printf("Found feed %s\n", feedURL)
 	}
 
-	_, err = s.db.CreateFeedFollow(context.Background(), followParams)
+	newFeed, err := addFetchedFeed(context.Background(), s.db, user, name, feedURL, rssFeed)
 	if err != nil {
 		return err
 	}
@@ -196,6 +309,37 @@ func handlerAddFeed(s *state, cmd command, user database.User) error {
 	return nil
 }
 
+// addFetchedFeed adds the feed at feedURL for user along with the metadata
+// of its document. Without a name the feed is named after its title.
+func addFetchedFeed(ctx context.Context, db *database.Queries, user database.User, name string, feedURL string, rssFeed *RSSFeed) (database.Feed, error) {
+	if name == "" {
+		name = strings.TrimSpace(html.UnescapeString(rssFeed.Channel.Title))
+	}
+	if name == "" {
+		name = feedURL
+	}
+
+	newFeed, err := addFeedForUser(ctx, db, user, name, feedURL)
+	if err != nil {
+		return database.Feed{}, err
+	}
+
+	channel := rssFeed.Channel
+	description := strings.TrimSpace(html.UnescapeString(channel.Description))
+	err = db.UpdateFeedMetadata(ctx, database.UpdateFeedMetadataParams{
+		ID:          newFeed.ID,
+		Description: sql.NullString{String: description, Valid: description != ""},
+		SiteUrl:     sql.NullString{String: channel.Link, Valid: channel.Link != ""},
+		Language:    sql.NullString{String: channel.Language, Valid: channel.Language != ""},
+		ImageUrl:    sql.NullString{String: channel.ImageURL, Valid: channel.ImageURL != ""},
+	})
+	if err != nil {
+		return database.Feed{}, err
+	}
+
+	return newFeed, nil
+}
+
 func handlerListFeeds(s *state, cmd command) error {
 
 	feeds, err := s.db.GetFeeds(context.Background())
@@ -209,31 +353,84 @@ func handlerListFeeds(s *state, cmd command) error {
 			return err
 		}
 
-		fmt.Printf("* %s - %s (%s)\n", feed.Name, feed.Url, user.Name)
+		output := fmt.Sprintf("* %s - %s (%s)", feed.Name, feed.Url, user.Name)
+		if feed.Disabled {
+			output += fmt.Sprintf(" [disabled: %s]", feed.LastError.String)
+		}
+		if feed.Description.Valid {
+			output += "\n    " + feed.Description.String
+		}
+		if feed.SiteUrl.Valid {
+			output += "\n    site: " + feed.SiteUrl.String
+		}
+		if feed.Language.Valid {
+			output += "\n    language: " + feed.Language.String
+		}
+		if feed.ImageUrl.Valid {
+			output += "\n    image: " + feed.ImageUrl.String
+		}
+		if feed.FetchFullContent {
+			output += "\n    full articles downloaded"
+		}
+
+		fmt.Println(output)
 	}
 
 	return nil
 }
 
+func handlerFeedEnable(s *state, args []string) error {
+	if len(args) < 1 {
+		return errors.New("not enough arguments. needs url")
+	}
+
+	feed, err := s.db.EnableFeed(context.Background(), args[0])
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Feed %s has been enabled\n", feed.Name)
+
+	return nil
+}
+
+func handlerFeed(s *state, cmd command) error {
+	if len(cmd.args) < 1 {
+		return errors.New("usage: feed enable|fulltext")
+	}
+
+	switch cmd.args[0] {
+	case "enable":
+		return handlerFeedEnable(s, cmd.args[1:])
+	case "fulltext":
+		return handlerFeedFullText(s, cmd.args[1:])
+	}
+
+	return fmt.Errorf("unknown feed command %q. use enable or fulltext", cmd.args[0])
+}
+
 func handlerFollow(s *state, cmd command, user database.User) error {
 	if len(cmd.args) < 1 {
 		return errors.New("not enough arguments. needs url")
 	}
 
 	feed, err := s.db.GetFeedByUrl(context.Background(), cmd.args[0])
+	if errors.Is(err, sql.ErrNoRows) {
+		// Maybe the url is the site of a feed we already know about.
+		feedURL, resolveErr := resolveFeedURL(context.Background(), cmd.args[0])
+		if resolveErr != nil {
+			return fmt.Errorf("%s is not a known feed: %w", cmd.args[0], resolveErr)
+		}
+		feed, err = s.db.GetFeedByUrl(context.Background(), feedURL)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("feed %s not found. add it first with addfeed", feedURL)
+		}
+	}
 	if err != nil {
 		return err
 	}
 
-	params := database.CreateFeedFollowParams{
-		ID:        uuid.New(),
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
-		UserID:    user.ID,
-		FeedID:    feed.ID,
-	}
-
-	followRecord, err := s.db.CreateFeedFollow(context.Background(), params)
+	followRecord, err := followFeed(context.Background(), s.db, user, feed.ID)
 	if err != nil {
 		return err
 	}
@@ -272,9 +469,41 @@ func handlerListFollows(s *state, cmd command, user database.User) error {
 		return err
 	}
 
+	tags, err := followTags(context.Background(), s.db, user)
+	if err != nil {
+		return err
+	}
+
+	groups := map[string][]database.GetFeedFollowsForUserRow{}
+	untagged := []database.GetFeedFollowsForUserRow{}
+	for _, feed := range feeds {
+		if len(tags[feed.ID]) == 0 {
+			untagged = append(untagged, feed)
+			continue
+		}
+		for _, tag := range tags[feed.ID] {
+			groups[tag] = append(groups[tag], feed)
+		}
+	}
+
+	names := slices.Sorted(maps.Keys(groups))
+
 	output := ""
-	for i, feed := range feeds {
-		output += fmt.Sprintf("%d - %s\n", i+1, feed.Name)
+	for _, name := range names {
+		output += fmt.Sprintf("%s\n", name)
+		for i, feed := range groups[name] {
+			output += fmt.Sprintf("  %d - %s (%d unread)\n", i+1, feed.Name, feed.UnreadCount)
+		}
+	}
+
+	// Without any tag the list stays flat.
+	indent := ""
+	if len(names) > 0 && len(untagged) > 0 {
+		output += "Untagged\n"
+		indent = "  "
+	}
+	for i, feed := range untagged {
+		output += fmt.Sprintf("%s%d - %s (%d unread)\n", indent, i+1, feed.Name, feed.UnreadCount)
 	}
 
 	fmt.Println(output)
@@ -282,70 +511,298 @@ func handlerListFollows(s *state, cmd command, user database.User) error {
 	return nil
 }
 
-func fetchFeed(ctx context.Context, feedURL string) (*RSSFeed, error) {
+// cacheValidators hold the response headers a server needs to answer a
+// conditional GET for a feed.
+type cacheValidators struct {
+	ETag         string
+	LastModified string
+}
+
+var errNotModified = errors.New("feed not modified")
+
+// feedTimeout bounds a whole feed request, so a host that never answers
+// does not hold a scrape worker forever.
+const feedTimeout = 30 * time.Second
+
+var feedClient = &http.Client{Timeout: feedTimeout}
+
+func fetchFeed(ctx context.Context, feedURL string, validators cacheValidators) (*RSSFeed, cacheValidators, error) {
 
 	req, err := http.NewRequestWithContext(ctx, "GET", feedURL, nil)
 	if err != nil {
 		fmt.Println(err)
-		return &RSSFeed{}, err
+		return &RSSFeed{}, validators, err
 	}
 	req.Header.Add("User-Agent", "gator")
+	if validators.ETag != "" {
+		req.Header.Add("If-None-Match", validators.ETag)
+	}
+	if validators.LastModified != "" {
+		req.Header.Add("If-Modified-Since", validators.LastModified)
+	}
 
-	client := http.Client{}
-	response, err := client.Do(req)
+	response, err := feedClient.Do(req)
 	if err != nil {
 		fmt.Println(err)
-		return &RSSFeed{}, err
+		return &RSSFeed{}, validators, err
 	}
 	body := response.Body
 	defer body.Close()
 
+	if response.StatusCode == http.StatusNotModified {
+		return &RSSFeed{}, validators, errNotModified
+	}
+	if response.StatusCode >= 400 {
+		return &RSSFeed{}, validators, fmt.Errorf("unexpected status fetching %s: %s", feedURL, response.Status)
+	}
+
 	data, err := io.ReadAll(body)
 	if err != nil {
 		fmt.Println(err)
-		return &RSSFeed{}, err
+		return &RSSFeed{}, validators, err
 	}
 
-	rssFeed := RSSFeed{}
-	err = xml.Unmarshal(data, &rssFeed)
+	rssFeed, err := parseFeed(response.Header.Get("Content-Type"), data)
 	if err != nil {
 		fmt.Println(err)
+		return &RSSFeed{}, validators, err
+	}
+
+	newValidators := cacheValidators{
+		ETag:         response.Header.Get("ETag"),
+		LastModified: response.Header.Get("Last-Modified"),
+	}
+
+	return rssFeed, newValidators, nil
+}
+
+// feedRootElement returns the local name of the first element in the
+// document, which tells RSS ("rss") and Atom ("feed") apart.
+func feedRootElement(data []byte) (string, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return "", err
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return start.Name.Local, nil
+		}
+	}
+}
+
+func parseFeed(contentType string, data []byte) (*RSSFeed, error) {
+	if isJSONFeed(contentType, data) {
+		jsonFeed := JSONFeed{}
+		err := json.Unmarshal(data, &jsonFeed)
+		if err != nil {
+			return &RSSFeed{}, err
+		}
+		return jsonFeed.toRSS(), nil
+	}
+
+	root, err := feedRootElement(data)
+	if err != nil {
 		return &RSSFeed{}, err
 	}
 
-	return &rssFeed, nil
+	switch root {
+	case "rss":
+		rssFeed := RSSFeed{}
+		err = xml.Unmarshal(data, &rssFeed)
+		if err != nil {
+			return &RSSFeed{}, err
+		}
+		return &rssFeed, nil
+	case "feed":
+		atomFeed := AtomFeed{}
+		err = xml.Unmarshal(data, &atomFeed)
+		if err != nil {
+			return &RSSFeed{}, err
+		}
+		return atomFeed.toRSS(), nil
+	default:
+		return &RSSFeed{}, fmt.Errorf("unsupported feed format: <%s>", root)
+	}
+}
+
+// scrapeFeeds claims up to batchSize feeds and fetches them with at most
+// concurrency requests in flight. Claiming skips rows locked by another
+// aggregator and leases the claimed feeds until the batch has had time to
+// finish, so several agg processes can share the same database.
+func scrapeFeeds(s *state, concurrency int, batchSize int) error {
+	feeds, err := s.db.ClaimFeedsToFetch(context.Background(), database.ClaimFeedsToFetchParams{
+		LeaseUntil: time.Now().Add(time.Duration(batchSize) * feedTimeout),
+		MaxFeeds:   int32(batchSize),
+	})
+	if err != nil {
+		return err
+	}
+
+	return fetchClaimedFeeds(s, os.Stdout, feeds, concurrency)
+}
+
+// fetchClaimedFeeds fetches feeds whose lease is held by the caller with
+// concurrency workers, reporting progress on out.
+func fetchClaimedFeeds(s *state, out io.Writer, feeds []database.Feed, concurrency int) error {
+	jobs := make(chan database.Feed)
+	errs := make(chan error, len(feeds))
+
+	var wg sync.WaitGroup
+	for range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for feed := range jobs {
+				errs <- recordScrapeResult(s, out, feed, scrapeFeed(s, out, feed))
+			}
+		}()
+	}
+
+	for _, feed := range feeds {
+		jobs <- feed
+	}
+	close(jobs)
+	wg.Wait()
+	close(errs)
+
+	var scrapeErrs []error
+	for err := range errs {
+		scrapeErrs = append(scrapeErrs, err)
+	}
+
+	return errors.Join(scrapeErrs...)
+}
+
+// recordScrapeResult stores the outcome of a fetch on the feed, so a
+// failing feed is logged and eventually disabled instead of stopping agg.
+func recordScrapeResult(s *state, out io.Writer, feed database.Feed, scrapeErr error) error {
+	if scrapeErr == nil {
+		return s.db.RecordFeedSuccess(context.Background(), feed.ID)
+	}
+
+	fmt.Fprintf(out, "error fetching feed '%s': %s\n", feed.Url, scrapeErr)
+
+	params := database.RecordFeedFailureParams{
+		LastError:   sql.NullString{String: scrapeErr.Error(), Valid: true},
+		MaxFailures: int32(s.cfg.FeedFailureLimit()),
+		ID:          feed.ID,
+	}
+
+	updatedFeed, err := s.db.RecordFeedFailure(context.Background(), params)
+	if err != nil {
+		return err
+	}
+
+	backoff := failureBackoff(updatedFeed.FailureCount)
+	err = scheduleFeed(s, feed.ID, time.Now().Add(backoff), time.Duration(feed.FetchIntervalSeconds)*time.Second)
+	if err != nil {
+		return err
+	}
+
+	if updatedFeed.Disabled {
+		fmt.Fprintf(out, "feed '%s' disabled after %d consecutive failures\n", feed.Url, updatedFeed.FailureCount)
+	}
+
+	return nil
+}
+
+func scheduleFeed(s *state, feedID uuid.UUID, next time.Time, interval time.Duration) error {
+	return s.db.ScheduleFeedFetch(context.Background(), database.ScheduleFeedFetchParams{
+		ID:                   feedID,
+		NextFetchAt:          sql.NullTime{Time: next, Valid: true},
+		FetchIntervalSeconds: int32(interval.Seconds()),
+	})
 }
 
-func scrapeFeeds(s *state) error {
-	nextFeed, err := s.db.GetNextFeedToFetch(context.Background())
+func scrapeFeed(s *state, out io.Writer, nextFeed database.Feed) error {
+	validators := cacheValidators{
+		ETag:         nextFeed.Etag.String,
+		LastModified: nextFeed.LastModified.String,
+	}
+
+	feed, newValidators, err := fetchFeed(context.Background(), nextFeed.Url, validators)
+	if errors.Is(err, errNotModified) {
+		fmt.Fprintf(out, "feed '%s' not modified\n", nextFeed.Url)
+		interval := time.Duration(nextFeed.FetchIntervalSeconds) * time.Second
+		return scheduleFeed(s, nextFeed.ID, time.Now().Add(interval), interval)
+	}
 	if err != nil {
 		return err
 	}
 
-	err = s.db.MarkFeedFetched(context.Background(), nextFeed.ID)
+	publishedDates, err := savePosts(context.Background(), s.db, out, nextFeed, feed)
 	if err != nil {
 		return err
 	}
 
-	feed, err := fetchFeed(context.Background(), nextFeed.Url)
+	// Only remember the validators once every item is stored, otherwise a
+	// failed run would be answered with 304 and its items lost.
+	if newValidators != validators {
+		err = s.db.UpdateFeedCacheHeaders(context.Background(), database.UpdateFeedCacheHeadersParams{
+			ID:           nextFeed.ID,
+			Etag:         sql.NullString{String: newValidators.ETag, Valid: newValidators.ETag != ""},
+			LastModified: sql.NullString{String: newValidators.LastModified, Valid: newValidators.LastModified != ""},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	err = recordWebSubHub(context.Background(), s.db, nextFeed, feed)
 	if err != nil {
 		return err
 	}
 
+	next, interval := scheduleNextFetch(time.Now(), feed, publishedDates)
+	return scheduleFeed(s, nextFeed.ID, next, interval)
+}
+
+// savePosts stores the items of a fetched or pushed feed document and
+// returns the publication dates it could parse.
+func savePosts(ctx context.Context, db *database.Queries, out io.Writer, nextFeed database.Feed, feed *RSSFeed) ([]time.Time, error) {
 	feed.Channel.Title = html.UnescapeString(feed.Channel.Title)
 	feed.Channel.Description = html.UnescapeString(feed.Channel.Description)
-	for _, rssItem := range feed.Channel.Item {
-		rssItem.Title = html.UnescapeString(rssItem.Title)
-		rssItem.Description = html.UnescapeString(rssItem.Description)
+	for i := range feed.Channel.Item {
+		feed.Channel.Item[i].Title = html.UnescapeString(feed.Channel.Item[i].Title)
+		feed.Channel.Item[i].Description = html.UnescapeString(feed.Channel.Item[i].Description)
+	}
+
+	rules, err := db.GetFilterRulesForFeed(ctx, nextFeed.ID)
+	if err != nil {
+		return nil, err
 	}
+	filters := compileRules(rules)
 
+	publishedDates := []time.Time{}
 	for _, item := range feed.Channel.Item {
-		publishedAt, err := time.Parse(time.RFC1123Z, item.PubDate)
+		if item.Title == "" && item.Link == "" {
+			fmt.Fprintf(out, "skipping item without title or link in feed '%s'\n", nextFeed.Url)
+			continue
+		}
+
+		publishedAt, err := parsePubDate(item.PubDate)
 		if err != nil {
-			return fmt.Errorf("error parsing date: %s", item.PubDate)
+			if !errors.Is(err, errNoPubDate) {
+				fmt.Fprintf(out, "item '%s': %s. Using first seen time\n", item.Title, err)
+			}
+			publishedAt = time.Now()
+		} else {
+			publishedDates = append(publishedDates, publishedAt)
+		}
+
+		guid := strings.TrimSpace(item.GUID)
+		if guid == "" {
+			guid = item.Link
+		}
+		if guid == "" {
+			guid = item.Title
 		}
 
-		params := database.CreatePostParams{
+		author := item.author()
+		comments := strings.TrimSpace(item.Comments)
+
+		params := database.UpsertPostParams{
 			ID:          uuid.New(),
 			CreatedAt:   time.Now(),
 			UpdatedAt:   time.Now(),
@@ -354,47 +811,200 @@ func scrapeFeeds(s *state) error {
 			Description: sql.NullString{String: item.Description, Valid: true},
 			PublishedAt: publishedAt,
 			FeedID:      nextFeed.ID,
+			Guid:        guid,
+			Content:     sql.NullString{String: item.Content, Valid: strings.TrimSpace(item.Content) != ""},
+			Author:      sql.NullString{String: author, Valid: author != ""},
+			CommentsUrl: sql.NullString{String: comments, Valid: comments != ""},
 		}
 
-		_, err = s.db.CreatePost(context.Background(), params)
+		post, err := db.UpsertPost(ctx, params)
 		if err != nil {
-			var pqErr *pq.Error
-			if errors.Is(err, pqErr) && pqErr.Code == "23505" {
-				fmt.Printf("post with url '%s' duplicated. Ignoring...", params.Url)
-			} else {
-				return err
+			return nil, err
+		}
+
+		err = savePostAttachments(ctx, db, post.ID, item)
+		if err != nil {
+			return nil, err
+		}
+
+		if post.Inserted {
+			// Rules run first so that hidden posts are not sent to webhooks.
+			err = applyRules(ctx, db, filters, post.ID, itemRuleSubject(item))
+			if err != nil {
+				return nil, err
+			}
+
+			_, err = db.CreateWebhookDeliveries(ctx, post.ID)
+			if err != nil {
+				return nil, err
+			}
+
+			// Items that ship their full content need no download.
+			if !post.Content.Valid {
+				_, err = db.CreateContentFetch(ctx, post.ID)
+				if err != nil {
+					return nil, err
+				}
 			}
 		}
 	}
 
+	return publishedDates, nil
+}
+
+// savePostAttachments stores the categories and enclosures of an item.
+// Ones that were dropped from the feed since are kept.
+func savePostAttachments(ctx context.Context, db *database.Queries, postID uuid.UUID, item RSSItem) error {
+	for _, category := range item.Categories {
+		category = strings.TrimSpace(category)
+		if category == "" {
+			continue
+		}
+
+		err := db.AddPostCategory(ctx, database.AddPostCategoryParams{PostID: postID, Name: category})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, enclosure := range item.Enclosures {
+		enclosureURL := strings.TrimSpace(enclosure.URL)
+		if enclosureURL == "" {
+			continue
+		}
+
+		length, parseErr := strconv.ParseInt(strings.TrimSpace(enclosure.Length), 10, 64)
+		err := db.UpsertPostEnclosure(ctx, database.UpsertPostEnclosureParams{
+			ID:        uuid.New(),
+			CreatedAt: time.Now(),
+			UpdatedAt: time.Now(),
+			PostID:    postID,
+			Url:       enclosureURL,
+			MimeType:  sql.NullString{String: enclosure.Type, Valid: enclosure.Type != ""},
+			Length:    sql.NullInt64{Int64: length, Valid: parseErr == nil && length > 0},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func handlerAPIKey(s *state, cmd command, user database.User) error {
+	fmt.Println(user.ApiKey)
+
 	return nil
 }
 
 func handlerBrowse(s *state, cmd command, user database.User) error {
-	var limit int32 = int32(2)
+	fs := flag.NewFlagSet("browse", flag.ContinueOnError)
+	unread := fs.Bool("unread", false, "only show posts that have not been read")
+	tag := fs.String("tag", "", "only show posts of feeds with this tag")
+	postTag := fs.String("post-tag", "", "only show posts a rule tagged with this")
+	feedURL := fs.String("feed", "", "only show posts of this feed")
+	since := fs.String("since", "", "only show posts published on or after this date (YYYY-MM-DD)")
+	until := fs.String("until", "", "only show posts published before this date (YYYY-MM-DD)")
+	after := fs.String("after", "", "only show posts older than the post with this id")
+	page := fs.Int("page", 1, "page of posts to show")
+	args, err := parseArgs(fs, cmd.args)
+	if err != nil {
+		return err
+	}
 
-	if len(cmd.args) > 0 {
-		argLimit, err := strconv.Atoi(cmd.args[0])
+	limit := s.cfg.BrowsePageSize()
+	if len(args) > 0 {
+		limit, err = strconv.Atoi(args[0])
 		if err != nil {
 			return err
 		}
+	}
 
-		limit = int32(argLimit)
+	if limit < 1 || *page < 1 {
+		return errors.New("limit and page must be positive numbers")
 	}
 
-	params := database.GetPostsForUserParams{
-		UserID: user.ID,
-		Limit:  limit,
+	params := database.GetTimelineForUserParams{
+		UserID:     user.ID,
+		FeedUrl:    sql.NullString{String: *feedURL, Valid: *feedURL != ""},
+		Tag:        sql.NullString{String: *tag, Valid: *tag != ""},
+		PostTag:    sql.NullString{String: *postTag, Valid: *postTag != ""},
+		UnreadOnly: *unread,
+		MaxPosts:   int32(limit),
 	}
 
-	posts, err := s.db.GetPostsForUser(context.Background(), params)
+	params.Since, err = parseDateFlag(*since)
 	if err != nil {
 		return err
 	}
+	params.Until, err = parseDateFlag(*until)
+	if err != nil {
+		return err
+	}
+
+	if *after != "" {
+		afterID, err := uuid.Parse(*after)
+		if err != nil {
+			return err
+		}
+		params.After = uuid.NullUUID{UUID: afterID, Valid: true}
+	}
+
+	// Pages are keyed on the last post of the previous one, so reaching a
+	// page means walking through the ones before it.
+	var posts []database.GetTimelineForUserRow
+	for current := 1; ; current++ {
+		posts, err = s.db.GetTimelineForUser(context.Background(), params)
+		if err != nil {
+			return err
+		}
+
+		if current == *page {
+			break
+		}
+		if len(posts) < limit {
+			posts = nil
+			break
+		}
+
+		params.After = uuid.NullUUID{UUID: posts[len(posts)-1].ID, Valid: true}
+	}
+
+	if len(posts) == 0 {
+		fmt.Println("No posts found")
+		return nil
+	}
 
 	output := ""
 	for i, post := range posts {
-		output += fmt.Sprintf("%d - %s\n", i+1, post.Title)
+		output += fmt.Sprintf("%d - %s (%s)\n", (*page-1)*limit+i+1, post.Title, post.ID)
+
+		categories, err := s.db.GetPostCategories(context.Background(), post.ID)
+		if err != nil {
+			return err
+		}
+		tags, err := s.db.GetPostTags(context.Background(), database.GetPostTagsParams{UserID: user.ID, PostID: post.ID})
+		if err != nil {
+			return err
+		}
+
+		details := []string{}
+		if post.Author.Valid {
+			details = append(details, "by "+post.Author.String)
+		}
+		if len(categories) > 0 {
+			details = append(details, strings.Join(categories, ", "))
+		}
+		if len(tags) > 0 {
+			details = append(details, "tagged "+strings.Join(tags, ", "))
+		}
+		if len(details) > 0 {
+			output += fmt.Sprintf("    %s\n", strings.Join(details, " · "))
+		}
+	}
+
+	if len(posts) == limit {
+		output += fmt.Sprintf("\nNext page: browse --after %s\n", posts[len(posts)-1].ID)
 	}
 
 	fmt.Println(output)
@@ -402,23 +1012,251 @@ func handlerBrowse(s *state, cmd command, user database.User) error {
 	return nil
 }
 
+func handlerRead(s *state, cmd command, user database.User) error {
+	fs := flag.NewFlagSet("read", flag.ContinueOnError)
+	markdown := fs.Bool("markdown", false, "print the post as Markdown")
+	width := fs.Int("width", 0, "wrap lines at this width (defaults to the terminal width)")
+	args, err := parseArgs(fs, cmd.args)
+	if err != nil {
+		return err
+	}
+
+	if len(args) < 1 {
+		return errors.New("not enough arguments. needs post id")
+	}
+
+	postID, err := uuid.Parse(args[0])
+	if err != nil {
+		return err
+	}
+
+	post, err := s.db.GetPostForUser(context.Background(), database.GetPostForUserParams{ID: postID, UserID: user.ID})
+	if errors.Is(err, sql.ErrNoRows) {
+		return errors.New("no post with that id in the feeds you follow")
+	} else if err != nil {
+		return err
+	}
+
+	if *width <= 0 {
+		*width = defaultRenderWidth
+		if terminalWidth, _, err := terminalSize(); err == nil {
+			*width = terminalWidth
+		}
+	}
+
+	categories, err := s.db.GetPostCategories(context.Background(), post.ID)
+	if err != nil {
+		return err
+	}
+	enclosures, err := s.db.GetPostEnclosures(context.Background(), post.ID)
+	if err != nil {
+		return err
+	}
+	tags, err := s.db.GetPostTags(context.Background(), database.GetPostTagsParams{UserID: user.ID, PostID: post.ID})
+	if err != nil {
+		return err
+	}
+
+	details := []string{}
+	if post.Author.Valid {
+		details = append(details, "By "+post.Author.String)
+	}
+	if len(categories) > 0 {
+		details = append(details, "Categories: "+strings.Join(categories, ", "))
+	}
+	if len(tags) > 0 {
+		details = append(details, "Tags: "+strings.Join(tags, ", "))
+	}
+	if post.CommentsUrl.Valid {
+		details = append(details, "Comments: "+post.CommentsUrl.String)
+	}
+
+	if *markdown {
+		fmt.Printf("# %s\n\n", post.Title)
+		fmt.Printf("<%s>\n\n", post.Url)
+		fmt.Printf("_%s_\n", post.PublishedAt.Format(time.RFC1123))
+		if len(details) > 0 {
+			fmt.Println()
+		}
+		for _, detail := range details {
+			fmt.Printf("- %s\n", detail)
+		}
+	} else {
+		fmt.Println(post.Title)
+		fmt.Println(post.Url)
+		fmt.Println(post.PublishedAt.Format(time.RFC1123))
+		for _, detail := range details {
+			fmt.Println(detail)
+		}
+	}
+	fmt.Println()
+	for _, line := range renderHTML(postContent(post.Content, post.Description), post.Url, *width, *markdown) {
+		fmt.Println(line)
+	}
+
+	if len(enclosures) > 0 {
+		fmt.Println()
+		fmt.Println("Attachments:")
+	}
+	for _, enclosure := range enclosures {
+		output := "* " + enclosure.Url
+		if *markdown {
+			output = fmt.Sprintf("- <%s>", enclosure.Url)
+		}
+		if enclosure.MimeType.Valid {
+			output += " " + enclosure.MimeType.String
+		}
+		if enclosure.Length.Valid {
+			output += " " + formatSize(enclosure.Length.Int64)
+		}
+		fmt.Println(output)
+	}
+
+	params := database.MarkPostReadParams{
+		UserID: user.ID,
+		PostID: post.ID,
+	}
+
+	return s.db.MarkPostRead(context.Background(), params)
+}
+
+// formatSize prints a number of bytes the way people read file sizes.
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+
+	value := float64(size) / unit
+	for _, suffix := range []string{"KB", "MB", "GB"} {
+		if value < unit {
+			return fmt.Sprintf("%.1f %s", value, suffix)
+		}
+		value /= unit
+	}
+	return fmt.Sprintf("%.1f TB", value)
+}
+
+func handlerMarkRead(s *state, cmd command, user database.User) error {
+	fs := flag.NewFlagSet("mark-read", flag.ContinueOnError)
+	feedURL := fs.String("feed", "", "mark the posts of this feed as read")
+	all := fs.Bool("all", false, "mark the posts of every followed feed as read")
+	before := fs.String("before", "", "mark posts published before this date (YYYY-MM-DD) as read")
+	_, err := parseArgs(fs, cmd.args)
+	if err != nil {
+		return err
+	}
+
+	if *feedURL == "" && !*all && *before == "" {
+		return errors.New("usage: mark-read --feed <url> | --all | --before <date>")
+	}
+
+	params := database.MarkPostsReadParams{
+		UserID: user.ID,
+	}
+
+	if *feedURL != "" {
+		feed, err := s.db.GetFeedByUrl(context.Background(), *feedURL)
+		if err != nil {
+			return err
+		}
+		params.FeedID = uuid.NullUUID{UUID: feed.ID, Valid: true}
+	}
+
+	if *before != "" {
+		beforeDate, err := time.Parse(time.DateOnly, *before)
+		if err != nil {
+			return err
+		}
+		params.Before = sql.NullTime{Time: beforeDate, Valid: true}
+	}
+
+	count, err := s.db.MarkPostsRead(context.Background(), params)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Marked %d posts as read\n", count)
+
+	return nil
+}
+
 func handlerAgg(s *state, cmd command) error {
-	if len(cmd.args) < 1 {
+	fs := flag.NewFlagSet("agg", flag.ContinueOnError)
+	digestInterval := fs.Duration("digest", 0, "also email digests to users whose last one is older than this")
+	args, err := parseArgs(fs, cmd.args)
+	if err != nil {
+		return err
+	}
+
+	if len(args) < 1 {
 		return errors.New("missing arg 'time_between_reqs'")
 	}
 
-	duration, err := time.ParseDuration(cmd.args[0])
+	duration, err := time.ParseDuration(args[0])
 	if err != nil {
 		return err
 	}
 
-	fmt.Printf("Collecting feeds every %s\n", duration)
+	concurrency := 1
+	if len(args) > 1 {
+		concurrency, err = strconv.Atoi(args[1])
+		if err != nil || concurrency < 1 {
+			return errors.New("concurrency must be a positive number")
+		}
+	}
+
+	batchSize := concurrency
+	if len(args) > 2 {
+		batchSize, err = strconv.Atoi(args[2])
+		if err != nil || batchSize < 1 {
+			return errors.New("batch size must be a positive number")
+		}
+	}
+
+	if *digestInterval > 0 && s.cfg.SMTP == nil {
+		return errNoSMTP
+	}
+
+	fmt.Printf("Collecting %d feeds every %s with %d workers\n", batchSize, duration, concurrency)
+
+	// Background work stops with agg, after finishing what it is sending.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		deliverWebhooksLoop(ctx, s.db)
+	}()
+	go func() {
+		defer wg.Done()
+		fetchFullContentLoop(ctx, s.db)
+	}()
 
 	ticker := time.NewTicker(duration)
-	for ; ; <-ticker.C {
-		err = scrapeFeeds(s)
+	defer ticker.Stop()
+
+	for {
+		err = scrapeFeeds(s, concurrency, batchSize)
 		if err != nil {
-			return err
+			fmt.Println(err)
+		}
+
+		if *digestInterval > 0 {
+			err = sendDueDigests(s, *digestInterval)
+			if err != nil {
+				fmt.Println(err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			fmt.Println("Stopped collecting feeds")
+			return nil
+		case <-ticker.C:
 		}
 	}
 }
@@ -430,8 +1268,7 @@ func middlewareLoggedIn(handler func(s *state, cmd command, user database.User)
 			fmt.Println(err)
 			os.Exit(1)
 		}
-		handler(s, cmd, currentUser)
-		return nil
+		return handler(s, cmd, currentUser)
 	}
 
 	return f
@@ -464,11 +1301,27 @@ func main() {
 	commandsStc.register("reset", handlerReset)
 	commandsStc.register("addfeed", middlewareLoggedIn(handlerAddFeed))
 	commandsStc.register("feeds", handlerListFeeds)
+	commandsStc.register("feed", handlerFeed)
 	commandsStc.register("follow", middlewareLoggedIn(handlerFollow))
 	commandsStc.register("unfollow", middlewareLoggedIn(handlerUnfollow))
 	commandsStc.register("following", middlewareLoggedIn(handlerListFollows))
+	commandsStc.register("import-opml", middlewareLoggedIn(handlerImportOPML))
+	commandsStc.register("export-opml", middlewareLoggedIn(handlerExportOPML))
+	commandsStc.register("export-feed", middlewareLoggedIn(handlerExportFeed))
 	commandsStc.register("browse", middlewareLoggedIn(handlerBrowse))
+	commandsStc.register("read", middlewareLoggedIn(handlerRead))
+	commandsStc.register("mark-read", middlewareLoggedIn(handlerMarkRead))
+	commandsStc.register("search", middlewareLoggedIn(handlerSearch))
+	commandsStc.register("tui", middlewareLoggedIn(handlerTUI))
+	commandsStc.register("digest", middlewareLoggedIn(handlerDigest))
+	commandsStc.register("set-email", middlewareLoggedIn(handlerSetEmail))
+	commandsStc.register("tag", middlewareLoggedIn(handlerTag))
+	commandsStc.register("rules", middlewareLoggedIn(handlerRules))
+	commandsStc.register("webhook", middlewareLoggedIn(handlerWebhook))
 	commandsStc.register("agg", handlerAgg)
+	commandsStc.register("apikey", middlewareLoggedIn(handlerAPIKey))
+	commandsStc.register("feedtoken", middlewareLoggedIn(handlerFeedToken))
+	commandsStc.register("serve", handlerServe)
 
 	args := os.Args
 
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"io"
+	"testing"
+
+	"github.com/alpsilva/go-blog-aggregator.git/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestSavePostsDecodesEntities(t *testing.T) {
+	fake, db := newFakeDB(t)
+	fake.answer("UpsertPost", func(args []driver.Value) []any {
+		return []any{database.UpsertPostRow{ID: uuid.New(), Inserted: true}}
+	})
+
+	feed := &RSSFeed{}
+	feed.Channel.Item = []RSSItem{{
+		Title:       "a &amp; b",
+		Link:        "https://example.com/a-and-b",
+		Description: "fish &amp; chips",
+	}}
+
+	_, err := savePosts(context.Background(), db, io.Discard, database.Feed{ID: uuid.New()}, feed)
+	if err != nil {
+		t.Fatalf("savePosts: %v", err)
+	}
+
+	upserts := fake.called("UpsertPost")
+	if len(upserts) != 1 {
+		t.Fatalf("expected 1 saved post, got %d", len(upserts))
+	}
+	// Title and description are the 4th and 6th parameters of UpsertPost.
+	if upserts[0][3] != "a & b" {
+		t.Errorf("stored title %q", upserts[0][3])
+	}
+	if upserts[0][5] != "fish & chips" {
+		t.Errorf("stored description %q", upserts[0][5])
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/alpsilva/go-blog-aggregator.git/internal/database"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+type OPML struct {
+	XMLName xml.Name      `xml:"opml"`
+	Version string        `xml:"version,attr"`
+	Head    OPMLHead      `xml:"head"`
+	Body    []OPMLOutline `xml:"body>outline"`
+}
+
+type OPMLHead struct {
+	Title       string `xml:"title"`
+	DateCreated string `xml:"dateCreated,omitempty"`
+}
+
+type OPMLOutline struct {
+	Text     string        `xml:"text,attr"`
+	Title    string        `xml:"title,attr,omitempty"`
+	Type     string        `xml:"type,attr,omitempty"`
+	XMLURL   string        `xml:"xmlUrl,attr,omitempty"`
+	HTMLURL  string        `xml:"htmlUrl,attr,omitempty"`
+	Outlines []OPMLOutline `xml:"outline"`
+}
+
+type opmlFeed struct {
+	name     string
+	url      string
+	category string
+}
+
+func (o OPMLOutline) label() string {
+	if o.Title != "" {
+		return o.Title
+	}
+	return o.Text
+}
+
+// collectOPMLFeeds flattens the outline tree. Outlines without an xmlUrl
+// are folders, and their path becomes the tag of the feeds inside.
+func collectOPMLFeeds(outlines []OPMLOutline, folders []string) []opmlFeed {
+	feeds := []opmlFeed{}
+	for _, outline := range outlines {
+		if outline.XMLURL == "" {
+			feeds = append(feeds, collectOPMLFeeds(outline.Outlines, append(folders, outline.label()))...)
+			continue
+		}
+
+		name := outline.label()
+		if name == "" {
+			name = outline.XMLURL
+		}
+
+		feeds = append(feeds, opmlFeed{
+			name:     name,
+			url:      outline.XMLURL,
+			category: strings.Join(folders, "/"),
+		})
+	}
+	return feeds
+}
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+func handlerImportOPML(s *state, cmd command, user database.User) error {
+	if len(cmd.args) < 1 {
+		return errors.New("not enough arguments. needs file")
+	}
+
+	data, err := os.ReadFile(cmd.args[0])
+	if err != nil {
+		return err
+	}
+
+	document := OPML{}
+	err = xml.Unmarshal(data, &document)
+	if err != nil {
+		return err
+	}
+
+	created, followed := 0, 0
+	for _, opmlFeed := range collectOPMLFeeds(document.Body, nil) {
+		feed, err := s.db.GetFeedByUrl(context.Background(), opmlFeed.url)
+		if errors.Is(err, sql.ErrNoRows) {
+			feed, err = s.db.CreateFeed(context.Background(), database.CreateFeedParams{
+				ID:        uuid.New(),
+				CreatedAt: time.Now(),
+				UpdatedAt: time.Now(),
+				UserID:    user.ID,
+				Name:      opmlFeed.name,
+				Url:       opmlFeed.url,
+			})
+			if err != nil {
+				return err
+			}
+			created++
+		} else if err != nil {
+			return err
+		}
+
+		_, err = followFeed(context.Background(), s.db, user, feed.ID)
+		if err == nil {
+			followed++
+		} else if !isUniqueViolation(err) {
+			return err
+		}
+
+		if opmlFeed.category != "" {
+			err = tagFollow(context.Background(), s.db, user, feed.ID, opmlFeed.category)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	fmt.Printf("Imported %s: %d new feeds, %d new follows\n", cmd.args[0], created, followed)
+
+	return nil
+}
+
+func handlerExportOPML(s *state, cmd command, user database.User) error {
+	follows, err := s.db.GetFeedFollowsForUser(context.Background(), user.ID)
+	if err != nil {
+		return err
+	}
+
+	document := OPML{
+		Version: "2.0",
+		Head: OPMLHead{
+			Title:       fmt.Sprintf("%s subscriptions in gator", user.Name),
+			DateCreated: time.Now().Format(time.RFC1123Z),
+		},
+	}
+
+	tags, err := followTags(context.Background(), s.db, user)
+	if err != nil {
+		return err
+	}
+
+	// Each tag becomes a folder. A feed with several tags is listed in each
+	// of their folders.
+	folders := map[string]int{}
+	for _, follow := range follows {
+		outline := OPMLOutline{
+			Text:   follow.Name,
+			Title:  follow.Name,
+			Type:   "rss",
+			XMLURL: follow.Url,
+		}
+
+		if len(tags[follow.ID]) == 0 {
+			document.Body = append(document.Body, outline)
+			continue
+		}
+
+		for _, tag := range tags[follow.ID] {
+			index, ok := folders[tag]
+			if !ok {
+				index = len(document.Body)
+				folders[tag] = index
+				document.Body = append(document.Body, OPMLOutline{Text: tag})
+			}
+			document.Body[index].Outlines = append(document.Body[index].Outlines, outline)
+		}
+	}
+
+	data, err := xml.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append([]byte(xml.Header), data...)
+
+	if len(cmd.args) == 0 {
+		fmt.Println(string(data))
+		return nil
+	}
+
+	err = os.WriteFile(cmd.args[0], data, 0644)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Exported %d feeds to %s\n", len(follows), cmd.args[0])
+
+	return nil
+}
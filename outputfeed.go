@@ -0,0 +1,329 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/xml"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alpsilva/go-blog-aggregator.git/internal/database"
+)
+
+const (
+	defaultOutputFeedLimit = 50
+	maxOutputFeedLimit     = 500
+	// outputFeedHomepage is the channel link of exported documents, which
+	// are not published anywhere gator knows of.
+	outputFeedHomepage = "https://github.com/alpsilva/go-blog-aggregator"
+)
+
+var errUnknownFeedFormat = errors.New("unknown feed format. use rss or atom")
+
+var outputFeedContentTypes = map[string]string{
+	"rss":  "application/rss+xml; charset=utf-8",
+	"atom": "application/atom+xml; charset=utf-8",
+}
+
+type outputRSS struct {
+	XMLName xml.Name         `xml:"rss"`
+	Version string           `xml:"version,attr"`
+	Channel outputRSSChannel `xml:"channel"`
+}
+
+type outputRSSChannel struct {
+	Title         string          `xml:"title"`
+	Link          string          `xml:"link"`
+	Description   string          `xml:"description"`
+	LastBuildDate string          `xml:"lastBuildDate"`
+	Generator     string          `xml:"generator"`
+	Items         []outputRSSItem `xml:"item"`
+}
+
+type outputRSSGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type outputRSSSource struct {
+	URL  string `xml:"url,attr"`
+	Name string `xml:",chardata"`
+}
+
+type outputRSSItem struct {
+	Title       string          `xml:"title"`
+	Link        string          `xml:"link,omitempty"`
+	Description string          `xml:"description,omitempty"`
+	PubDate     string          `xml:"pubDate"`
+	GUID        outputRSSGUID   `xml:"guid"`
+	Source      outputRSSSource `xml:"source"`
+}
+
+type outputAtom struct {
+	XMLName   xml.Name          `xml:"http://www.w3.org/2005/Atom feed"`
+	Title     string            `xml:"title"`
+	ID        string            `xml:"id"`
+	Updated   string            `xml:"updated"`
+	Generator string            `xml:"generator"`
+	Links     []outputAtomLink  `xml:"link"`
+	Entries   []outputAtomEntry `xml:"entry"`
+}
+
+type outputAtomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type outputAtomText struct {
+	Type string `xml:"type,attr"`
+	Text string `xml:",chardata"`
+}
+
+type outputAtomSource struct {
+	Title string           `xml:"title"`
+	ID    string           `xml:"id"`
+	Links []outputAtomLink `xml:"link"`
+}
+
+type outputAtomEntry struct {
+	Title     string           `xml:"title"`
+	ID        string           `xml:"id"`
+	Published string           `xml:"published"`
+	Updated   string           `xml:"updated"`
+	Links     []outputAtomLink `xml:"link"`
+	Summary   *outputAtomText  `xml:"summary"`
+	Source    outputAtomSource `xml:"source"`
+}
+
+type outputFeedOptions struct {
+	format     string
+	feedURL    string
+	tag        string
+	unreadOnly bool
+	limit      int
+	// selfURL is where the document is published, if anywhere.
+	selfURL string
+}
+
+func (o outputFeedOptions) params(user database.User) database.GetTimelineForUserParams {
+	return database.GetTimelineForUserParams{
+		UserID:     user.ID,
+		FeedUrl:    sql.NullString{String: o.feedURL, Valid: o.feedURL != ""},
+		Tag:        sql.NullString{String: o.tag, Valid: o.tag != ""},
+		UnreadOnly: o.unreadOnly,
+		MaxPosts:   int32(o.limit),
+	}
+}
+
+func outputFeedTitle(user database.User) string {
+	return fmt.Sprintf("%s's gator timeline", user.Name)
+}
+
+// timelineUpdated is the date of the newest post, which is what readers
+// compare to know whether anything changed.
+func timelineUpdated(posts []database.GetTimelineForUserRow) time.Time {
+	updated := time.Unix(0, 0).UTC()
+	for _, post := range posts {
+		if post.PublishedAt.After(updated) {
+			updated = post.PublishedAt
+		}
+	}
+	return updated
+}
+
+func buildOutputRSS(user database.User, posts []database.GetTimelineForUserRow, selfURL string) any {
+	link := selfURL
+	if link == "" {
+		link = outputFeedHomepage
+	}
+
+	document := outputRSS{
+		Version: "2.0",
+		Channel: outputRSSChannel{
+			Title:         outputFeedTitle(user),
+			Link:          link,
+			Description:   fmt.Sprintf("Posts from the feeds %s follows in gator", user.Name),
+			LastBuildDate: timelineUpdated(posts).Format(time.RFC1123Z),
+			Generator:     "gator",
+		},
+	}
+
+	for _, post := range posts {
+		document.Channel.Items = append(document.Channel.Items, outputRSSItem{
+			Title:       post.Title,
+			Link:        post.Url,
+			Description: post.Description.String,
+			PubDate:     post.PublishedAt.Format(time.RFC1123Z),
+			GUID:        outputRSSGUID{Value: "urn:uuid:" + post.ID.String()},
+			Source:      outputRSSSource{URL: post.FeedUrl, Name: post.FeedName},
+		})
+	}
+
+	return document
+}
+
+func buildOutputAtom(user database.User, posts []database.GetTimelineForUserRow, selfURL string) any {
+	document := outputAtom{
+		Title:     outputFeedTitle(user),
+		ID:        "urn:uuid:" + user.ID.String(),
+		Updated:   timelineUpdated(posts).Format(time.RFC3339),
+		Generator: "gator",
+	}
+	if selfURL != "" {
+		document.Links = []outputAtomLink{{Href: selfURL, Rel: "self", Type: "application/atom+xml"}}
+	}
+
+	for _, post := range posts {
+		entry := outputAtomEntry{
+			Title:     post.Title,
+			ID:        "urn:uuid:" + post.ID.String(),
+			Published: post.PublishedAt.Format(time.RFC3339),
+			Updated:   post.UpdatedAt.Format(time.RFC3339),
+			Source: outputAtomSource{
+				Title: post.FeedName,
+				ID:    post.FeedUrl,
+				Links: []outputAtomLink{{Href: post.FeedUrl, Rel: "self"}},
+			},
+		}
+		if post.Url != "" {
+			entry.Links = []outputAtomLink{{Href: post.Url, Rel: "alternate"}}
+		}
+		if post.Description.Valid && post.Description.String != "" {
+			entry.Summary = &outputAtomText{Type: "html", Text: post.Description.String}
+		}
+		document.Entries = append(document.Entries, entry)
+	}
+
+	return document
+}
+
+// renderOutputFeed writes the timeline of user matching options as an RSS
+// 2.0 or Atom document, and returns it with its content type.
+func renderOutputFeed(ctx context.Context, db *database.Queries, user database.User, options outputFeedOptions) ([]byte, string, error) {
+	contentType, ok := outputFeedContentTypes[options.format]
+	if !ok {
+		return nil, "", errUnknownFeedFormat
+	}
+
+	posts, err := db.GetTimelineForUser(ctx, options.params(user))
+	if err != nil {
+		return nil, "", err
+	}
+
+	document := buildOutputRSS(user, posts, options.selfURL)
+	if options.format == "atom" {
+		document = buildOutputAtom(user, posts, options.selfURL)
+	}
+
+	data, err := xml.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return nil, "", err
+	}
+
+	return append([]byte(xml.Header), data...), contentType, nil
+}
+
+func handlerExportFeed(s *state, cmd command, user database.User) error {
+	fs := flag.NewFlagSet("export-feed", flag.ContinueOnError)
+	format := fs.String("format", "rss", "document format, rss or atom")
+	feedURL := fs.String("feed", "", "only include posts of this feed")
+	tag := fs.String("tag", "", "only include posts of feeds with this tag")
+	unread := fs.Bool("unread", false, "only include posts that have not been read")
+	limit := fs.Int("limit", defaultOutputFeedLimit, "maximum number of posts")
+	args, err := parseArgs(fs, cmd.args)
+	if err != nil {
+		return err
+	}
+
+	data, _, err := renderOutputFeed(context.Background(), s.db, user, outputFeedOptions{
+		format:     *format,
+		feedURL:    *feedURL,
+		tag:        *tag,
+		unreadOnly: *unread,
+		limit:      *limit,
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		fmt.Println(string(data))
+		return nil
+	}
+
+	err = os.WriteFile(args[0], data, 0644)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Exported timeline to %s\n", args[0])
+
+	return nil
+}
+
+func handlerFeedToken(s *state, cmd command, user database.User) error {
+	fmt.Println(user.FeedToken)
+
+	return nil
+}
+
+// handlerOutputFeed serves the timeline of the user owning the token in the
+// path. Feed readers cannot send headers, so the token stands in for the
+// API key and only grants read access to this document.
+func (a *apiServer) handlerOutputFeed(w http.ResponseWriter, r *http.Request) {
+	user, err := a.db.GetUserByFeedToken(r.Context(), r.PathValue("token"))
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+
+	query := r.URL.Query()
+	options := outputFeedOptions{
+		format:     query.Get("format"),
+		feedURL:    query.Get("feed"),
+		tag:        query.Get("tag"),
+		unreadOnly: query.Get("unread") == "true",
+		limit:      defaultOutputFeedLimit,
+		selfURL:    a.publicURL(r),
+	}
+	if options.format == "" {
+		options.format = "rss"
+	}
+	if query.Has("limit") {
+		options.limit, err = strconv.Atoi(query.Get("limit"))
+		if err != nil || options.limit < 1 {
+			respondWithError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		options.limit = min(options.limit, maxOutputFeedLimit)
+	}
+
+	data, contentType, err := renderOutputFeed(r.Context(), a.db, user, options)
+	if errors.Is(err, errUnknownFeedFormat) {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	} else if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// publicURL is the address r was made to as seen from outside, or empty
+// when the server doesn't know its base url.
+func (a *apiServer) publicURL(r *http.Request) string {
+	if a.baseURL == "" {
+		return ""
+	}
+	return strings.TrimSuffix(a.baseURL, "/") + r.URL.RequestURI()
+}
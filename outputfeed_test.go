@@ -0,0 +1,44 @@
+package main
+
+import (
+	"database/sql/driver"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alpsilva/go-blog-aggregator.git/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestOutputFeedLinksToBaseURL(t *testing.T) {
+	fake, db := newFakeDB(t)
+	fake.answer("GetUserByFeedToken", func(args []driver.Value) []any {
+		return []any{database.User{ID: uuid.New(), Name: "jane", FeedToken: "token"}}
+	})
+
+	get := func(api apiServer) string {
+		t.Helper()
+
+		req := httptest.NewRequest("GET", "/feeds/token?format=atom", nil)
+		req.Host = "attacker.example.com"
+		recorder := httptest.NewRecorder()
+		api.routes().ServeHTTP(recorder, req)
+
+		body, _ := io.ReadAll(recorder.Result().Body)
+		if recorder.Code != 200 {
+			t.Fatalf("feed answered with %d: %s", recorder.Code, body)
+		}
+		return string(body)
+	}
+
+	document := get(apiServer{db: db, baseURL: "https://gator.example.com/"})
+	if !strings.Contains(document, `href="https://gator.example.com/feeds/token?format=atom" rel="self"`) {
+		t.Errorf("document doesn't link to the base url:\n%s", document)
+	}
+
+	document = get(apiServer{db: db})
+	if strings.Contains(document, "attacker.example.com") || strings.Contains(document, `rel="self"`) {
+		t.Errorf("document links to the request host:\n%s", document)
+	}
+}
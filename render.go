@@ -0,0 +1,572 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+)
+
+const (
+	defaultRenderWidth = 80
+	// minRenderWidth keeps deeply nested quotes and lists readable on
+	// narrow terminals.
+	minRenderWidth = 20
+)
+
+type htmlTokenKind int
+
+const (
+	textToken htmlTokenKind = iota
+	startTagToken
+	endTagToken
+)
+
+type htmlToken struct {
+	kind  htmlTokenKind
+	name  string
+	attrs map[string]string
+	text  string
+}
+
+// skippedElements are dropped along with everything inside them.
+var skippedElements = map[string]bool{
+	"script":   true,
+	"style":    true,
+	"head":     true,
+	"title":    true,
+	"template": true,
+	"noscript": true,
+	"svg":      true,
+}
+
+// blockElements start on a new line, the ones set to true are also set
+// apart from their surroundings by a blank line.
+var blockElements = map[string]bool{
+	"p":          true,
+	"section":    true,
+	"article":    true,
+	"header":     true,
+	"footer":     true,
+	"main":       true,
+	"aside":      true,
+	"figure":     true,
+	"table":      true,
+	"dl":         true,
+	"address":    true,
+	"div":        false,
+	"tr":         false,
+	"dt":         false,
+	"dd":         false,
+	"figcaption": false,
+}
+
+// tokenizeHTML parses markup the way browsers do and returns its text and
+// tags in document order. Every element is closed, even when the markup
+// leaves it open, and a "<" that does not start a tag is text.
+func tokenizeHTML(markup string) []htmlToken {
+	document, err := html.Parse(strings.NewReader(markup))
+	if err != nil {
+		// Only reading markup can fail, and a string can always be read.
+		return nil
+	}
+
+	tokens := []htmlToken{}
+	var walk func(*html.Node)
+	walk = func(node *html.Node) {
+		switch node.Type {
+		case html.TextNode:
+			tokens = append(tokens, htmlToken{kind: textToken, text: node.Data})
+			return
+		case html.ElementNode:
+			attrs := map[string]string{}
+			for _, attr := range node.Attr {
+				attrs[attr.Key] = attr.Val
+			}
+			tokens = append(tokens, htmlToken{kind: startTagToken, name: node.Data, attrs: attrs})
+			defer func() {
+				tokens = append(tokens, htmlToken{kind: endTagToken, name: node.Data})
+			}()
+		case html.DocumentNode:
+		default:
+			// Comments and doctypes.
+			return
+		}
+
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(document)
+
+	return tokens
+}
+
+// renderBlock is an open blockquote or list item, which indents the lines
+// inside it.
+type renderBlock struct {
+	name   string
+	prefix string
+	// marker replaces prefix on the first line of a list item.
+	marker string
+	// list is the depth of the list the item belongs to.
+	list int
+}
+
+type renderList struct {
+	ordered bool
+	count   int
+}
+
+// renderer lays out the tokens of a post as lines of text, collecting the
+// text of the current block until a block boundary flushes it.
+type renderer struct {
+	width        int
+	markdown     bool
+	base         *url.URL
+	lines        []string
+	text         strings.Builder
+	spaced       bool
+	blankPending bool
+	blocks       []renderBlock
+	lists        []renderList
+	links        []string
+	linkIndexes  map[string]int
+	openLinks    []string
+	pre          int
+	skip         int
+}
+
+// renderHTML turns the HTML of a post into lines of at most width runes,
+// as plain text or as Markdown. Links are numbered and listed at the end,
+// relative ones resolved against baseURL.
+func renderHTML(markup string, baseURL string, width int, markdown bool) []string {
+	r := &renderer{
+		width:       width,
+		markdown:    markdown,
+		linkIndexes: map[string]int{},
+	}
+	if base, err := url.Parse(baseURL); err == nil && base.IsAbs() {
+		r.base = base
+	}
+
+	for _, token := range tokenizeHTML(markup) {
+		switch token.kind {
+		case textToken:
+			r.addText(token.text)
+		case startTagToken:
+			r.startTag(token)
+		case endTagToken:
+			r.endTag(token.name)
+		}
+	}
+	r.flush()
+
+	r.blocks = nil
+	if len(r.links) > 0 {
+		r.paragraph()
+		for i, link := range r.links {
+			if r.markdown {
+				r.emit(fmt.Sprintf("[%d]: %s", i+1, link))
+			} else {
+				r.emit(fmt.Sprintf("[%d] %s", i+1, link))
+			}
+		}
+	}
+
+	return r.lines
+}
+
+func (r *renderer) write(text string) {
+	if r.skip > 0 {
+		return
+	}
+	r.text.WriteString(text)
+	r.spaced = false
+}
+
+// openMarkup writes Markdown that starts a span, the whitespace after it
+// moves out of the span.
+func (r *renderer) openMarkup(markup string) {
+	if !r.markdown || r.skip > 0 {
+		return
+	}
+	r.text.WriteString(markup)
+	r.spaced = true
+}
+
+// closeMarkup writes Markdown that ends a span, keeping the whitespace
+// before it outside of the span.
+func (r *renderer) closeMarkup(markup string) {
+	if !r.markdown || r.skip > 0 {
+		return
+	}
+	if !r.spaced {
+		r.text.WriteString(markup)
+		return
+	}
+
+	text := strings.TrimSuffix(r.text.String(), " ")
+	r.text.Reset()
+	r.text.WriteString(text + markup + " ")
+}
+
+// addText appends text to the current block, collapsing whitespace outside
+// of preformatted blocks.
+func (r *renderer) addText(text string) {
+	if r.skip > 0 || text == "" {
+		return
+	}
+	if r.pre > 0 {
+		r.text.WriteString(text)
+		return
+	}
+
+	for _, c := range text {
+		if unicode.IsSpace(c) {
+			if r.text.Len() > 0 && !r.spaced {
+				r.text.WriteByte(' ')
+				r.spaced = true
+			}
+			continue
+		}
+		r.text.WriteRune(c)
+		r.spaced = false
+	}
+}
+
+func (r *renderer) prefix(first bool) string {
+	prefix := ""
+	for _, block := range r.blocks {
+		if first && block.marker != "" {
+			prefix += block.marker
+		} else {
+			prefix += block.prefix
+		}
+	}
+	return prefix
+}
+
+// emit adds a line inside the open blocks, preceded by a blank line if a
+// paragraph ended before it.
+func (r *renderer) emit(line string) {
+	r.separate()
+	r.lines = append(r.lines, strings.TrimRight(r.prefix(true)+line, " "))
+	for i := range r.blocks {
+		r.blocks[i].marker = ""
+	}
+}
+
+// separate adds the blank line a paragraph that ended asked for.
+func (r *renderer) separate() {
+	// Lines holding only quote markers are blank already.
+	if r.blankPending && len(r.lines) > 0 && strings.Trim(r.lines[len(r.lines)-1], "> ") != "" {
+		r.lines = append(r.lines, strings.TrimRight(r.prefix(false), " "))
+	}
+	r.blankPending = false
+}
+
+// flush lays out the text collected so far.
+func (r *renderer) flush() {
+	text := r.text.String()
+	r.text.Reset()
+	r.spaced = false
+
+	if r.pre > 0 {
+		text = strings.TrimPrefix(text, "\n")
+		text = strings.TrimRight(text, "\n")
+		if text == "" {
+			return
+		}
+		for _, line := range strings.Split(text, "\n") {
+			r.emit(strings.TrimRight(line, " \t\r"))
+		}
+		return
+	}
+
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return
+	}
+
+	width := r.width - len([]rune(r.prefix(false)))
+	if width < minRenderWidth {
+		width = minRenderWidth
+	}
+	for _, line := range wrapText(text, width) {
+		r.emit(line)
+	}
+}
+
+// paragraph ends the current block and sets the next one apart with a
+// blank line.
+func (r *renderer) paragraph() {
+	r.flush()
+	r.blankPending = true
+}
+
+func (r *renderer) popBlock(name string) {
+	for i := len(r.blocks) - 1; i >= 0; i-- {
+		if r.blocks[i].name == name {
+			r.blocks = r.blocks[:i]
+			return
+		}
+	}
+}
+
+func (r *renderer) link(href string) int {
+	index, ok := r.linkIndexes[href]
+	if !ok {
+		r.links = append(r.links, href)
+		index = len(r.links)
+		r.linkIndexes[href] = index
+	}
+	return index
+}
+
+// resolveLink returns the absolute address of href, or "" for links that
+// are not worth listing such as anchors within the post.
+func (r *renderer) resolveLink(href string) string {
+	href = strings.TrimSpace(href)
+	if href == "" || strings.HasPrefix(href, "#") {
+		return ""
+	}
+
+	link, err := url.Parse(href)
+	if err != nil {
+		return ""
+	}
+	if r.base != nil {
+		link = r.base.ResolveReference(link)
+	}
+	if link.Scheme == "javascript" {
+		return ""
+	}
+
+	return link.String()
+}
+
+func (r *renderer) startTag(token htmlToken) {
+	if skippedElements[token.name] {
+		r.skip++
+		return
+	}
+	if r.skip > 0 {
+		return
+	}
+
+	if blank, ok := blockElements[token.name]; ok {
+		if blank {
+			r.paragraph()
+		} else {
+			r.flush()
+		}
+		return
+	}
+
+	switch token.name {
+	case "br":
+		if r.pre > 0 {
+			r.text.WriteByte('\n')
+		} else {
+			r.flush()
+		}
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		r.paragraph()
+		if r.markdown {
+			level, _ := strconv.Atoi(token.name[1:])
+			r.write(strings.Repeat("#", level) + " ")
+		}
+	case "ul", "ol":
+		r.flush()
+		if len(r.lists) == 0 {
+			r.blankPending = true
+		}
+		r.lists = append(r.lists, renderList{ordered: token.name == "ol"})
+	case "li":
+		r.flush()
+		if len(r.lists) == 0 {
+			r.lists = append(r.lists, renderList{})
+		}
+		// The end tag of list items is optional.
+		if len(r.blocks) > 0 && r.blocks[len(r.blocks)-1].name == "li" && r.blocks[len(r.blocks)-1].list == len(r.lists) {
+			r.blocks = r.blocks[:len(r.blocks)-1]
+		}
+
+		list := &r.lists[len(r.lists)-1]
+		list.count++
+		marker := "• "
+		if list.ordered {
+			marker = fmt.Sprintf("%d. ", list.count)
+		} else if r.markdown {
+			marker = "- "
+		}
+		r.blocks = append(r.blocks, renderBlock{
+			name:   "li",
+			prefix: strings.Repeat(" ", len([]rune(marker))),
+			marker: marker,
+			list:   len(r.lists),
+		})
+	case "blockquote":
+		r.paragraph()
+		// The blank line before the quote is outside of it.
+		r.separate()
+		r.blocks = append(r.blocks, renderBlock{name: "blockquote", prefix: "> "})
+	case "pre":
+		r.paragraph()
+		if r.markdown {
+			r.emit("```")
+		}
+		r.pre++
+	case "hr":
+		r.paragraph()
+		if r.markdown {
+			r.emit("---")
+		} else {
+			r.emit(strings.Repeat("─", min(r.width, 40)))
+		}
+		r.blankPending = true
+	case "a":
+		href := r.resolveLink(token.attrs["href"])
+		r.openLinks = append(r.openLinks, href)
+		if href != "" {
+			r.openMarkup("[")
+		}
+	case "img":
+		alt := strings.Join(strings.Fields(token.attrs["alt"]), " ")
+		src := r.resolveLink(token.attrs["src"])
+		if r.markdown && src != "" {
+			r.write(fmt.Sprintf("![%s](%s)", alt, src))
+		} else if alt != "" {
+			r.write(fmt.Sprintf("[image: %s]", alt))
+		}
+	case "b", "strong":
+		r.openMarkup("**")
+	case "i", "em":
+		r.openMarkup("_")
+	case "code":
+		if r.pre == 0 {
+			r.openMarkup("`")
+		}
+	}
+}
+
+func (r *renderer) endTag(name string) {
+	if skippedElements[name] {
+		if r.skip > 0 {
+			r.skip--
+		}
+		return
+	}
+	if r.skip > 0 {
+		return
+	}
+
+	if blank, ok := blockElements[name]; ok {
+		if blank {
+			r.paragraph()
+		} else {
+			r.flush()
+		}
+		return
+	}
+
+	switch name {
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		r.paragraph()
+	case "ul", "ol":
+		r.flush()
+		for len(r.blocks) > 0 && r.blocks[len(r.blocks)-1].name == "li" && r.blocks[len(r.blocks)-1].list == len(r.lists) {
+			r.blocks = r.blocks[:len(r.blocks)-1]
+		}
+		if len(r.lists) > 0 {
+			r.lists = r.lists[:len(r.lists)-1]
+		}
+		if len(r.lists) == 0 {
+			r.blankPending = true
+		}
+	case "li":
+		r.flush()
+		if len(r.blocks) > 0 && r.blocks[len(r.blocks)-1].name == "li" {
+			r.blocks = r.blocks[:len(r.blocks)-1]
+		}
+	case "blockquote":
+		r.flush()
+		r.popBlock("blockquote")
+		r.blankPending = true
+	case "pre":
+		r.flush()
+		if r.pre > 0 {
+			r.pre--
+		}
+		if r.markdown {
+			r.emit("```")
+		}
+		r.blankPending = true
+	case "a":
+		if len(r.openLinks) == 0 {
+			return
+		}
+		href := r.openLinks[len(r.openLinks)-1]
+		r.openLinks = r.openLinks[:len(r.openLinks)-1]
+		if href == "" {
+			return
+		}
+		if r.markdown {
+			r.closeMarkup(fmt.Sprintf("][%d]", r.link(href)))
+		} else {
+			r.write(fmt.Sprintf("[%d]", r.link(href)))
+		}
+	case "b", "strong":
+		r.closeMarkup("**")
+	case "i", "em":
+		r.closeMarkup("_")
+	case "code":
+		if r.pre == 0 {
+			r.closeMarkup("`")
+		}
+	case "td", "th":
+		r.addText(" ")
+	}
+}
+
+// postContent is the HTML to show for a post: its full article when gator
+// downloaded it, its description otherwise.
+func postContent(content sql.NullString, description sql.NullString) string {
+	if content.Valid {
+		return content.String
+	}
+	return description.String
+}
+
+// wrapText breaks text into lines of at most width runes.
+func wrapText(text string, width int) []string {
+	lines := []string{}
+	for _, paragraph := range strings.Split(text, "\n") {
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			for len([]rune(word)) > width {
+				if line != "" {
+					lines = append(lines, line)
+					line = ""
+				}
+				lines = append(lines, string([]rune(word)[:width]))
+				word = string([]rune(word)[width:])
+			}
+			if line == "" {
+				line = word
+			} else if len([]rune(line))+1+len([]rune(word)) <= width {
+				line += " " + word
+			} else {
+				lines = append(lines, line)
+				line = word
+			}
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRenderHTML(t *testing.T) {
+	tests := []struct {
+		name     string
+		markup   string
+		markdown bool
+		want     []string
+	}{
+		{
+			name:   "stray <",
+			markup: "a <3 b > c",
+			want:   []string{"a <3 b > c"},
+		},
+		{
+			name:     "unclosed link",
+			markup:   "see <a href=x>this",
+			markdown: true,
+			want:     []string{"see [this][1]", "", "[1]: https://example.com/posts/x"},
+		},
+		{
+			name:     "unclosed emphasis",
+			markup:   "<p>some <b>bold",
+			markdown: true,
+			want:     []string{"some **bold**"},
+		},
+		{
+			// Browsers drop a tag that runs to the end of the document.
+			name:   "unclosed attribute",
+			markup: `before <a href="x>after`,
+			want:   []string{"before"},
+		},
+		{
+			name:   "optional end tags",
+			markup: "<p>one<p>two<ul><li>a<li>b</ul>",
+			want:   []string{"one", "", "two", "", "• a", "• b"},
+		},
+		{
+			name:   "entities and skipped elements",
+			markup: "<style>p { color: red }</style><p>fish &amp; chips<script>alert(1)</script>",
+			want:   []string{"fish & chips"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := renderHTML(test.markup, "https://example.com/posts/", 80, test.markdown)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("renderHTML(%q) = %q, want %q", test.markup, got, test.want)
+			}
+		})
+	}
+}
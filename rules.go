@@ -0,0 +1,388 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/alpsilva/go-blog-aggregator.git/internal/database"
+	"github.com/google/uuid"
+)
+
+var ruleFields = []string{"title", "description", "url", "author", "category"}
+
+var ruleActions = []string{"hide", "read", "star", "tag"}
+
+// ruleSubject is the part of a post that rules look at.
+type ruleSubject struct {
+	title       string
+	description string
+	url         string
+	author      string
+	categories  []string
+}
+
+func itemRuleSubject(item RSSItem) ruleSubject {
+	return ruleSubject{
+		title:       item.Title,
+		description: item.Description,
+		url:         item.Link,
+		author:      item.author(),
+		categories:  item.Categories,
+	}
+}
+
+func postRuleSubject(post database.Post, categories []string) ruleSubject {
+	return ruleSubject{
+		title:       post.Title,
+		description: post.Description.String,
+		url:         post.Url,
+		author:      post.Author.String,
+		categories:  categories,
+	}
+}
+
+// followedPostCategories maps the posts of the feeds the user follows to
+// their categories.
+func followedPostCategories(ctx context.Context, db *database.Queries, user database.User) (map[uuid.UUID][]string, error) {
+	rows, err := db.GetFollowedPostCategoriesForUser(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	categories := map[uuid.UUID][]string{}
+	for _, row := range rows {
+		categories[row.PostID] = append(categories[row.PostID], row.Name)
+	}
+	return categories, nil
+}
+
+type filterRule struct {
+	database.FilterRule
+	regex *regexp.Regexp
+}
+
+func compileRule(rule database.FilterRule) (filterRule, error) {
+	compiled := filterRule{FilterRule: rule}
+	if !rule.IsRegex {
+		return compiled, nil
+	}
+
+	regex, err := regexp.Compile(rule.Pattern)
+	if err != nil {
+		return filterRule{}, err
+	}
+	compiled.regex = regex
+
+	return compiled, nil
+}
+
+// compileRules skips the rules that do not compile rather than failing the
+// whole batch, rules are validated when they are added.
+func compileRules(rules []database.FilterRule) []filterRule {
+	compiled := []filterRule{}
+	for _, rule := range rules {
+		filter, err := compileRule(rule)
+		if err != nil {
+			fmt.Printf("skipping rule %s: %s\n", rule.ID, err)
+			continue
+		}
+		compiled = append(compiled, filter)
+	}
+	return compiled
+}
+
+// matchesText is a case insensitive substring match, or a regex match for
+// regex rules.
+func (r filterRule) matchesText(text string) bool {
+	if r.regex != nil {
+		return r.regex.MatchString(text)
+	}
+	return strings.Contains(strings.ToLower(text), strings.ToLower(r.Pattern))
+}
+
+func (r filterRule) matches(subject ruleSubject) bool {
+	switch r.Field {
+	case "title":
+		return r.matchesText(subject.title)
+	case "description":
+		return r.matchesText(subject.description)
+	case "url":
+		return r.matchesText(subject.url)
+	case "author":
+		return r.matchesText(subject.author)
+	case "category":
+		return slices.ContainsFunc(subject.categories, r.matchesText)
+	}
+	return false
+}
+
+func (r filterRule) String() string {
+	operator := "contains"
+	if r.IsRegex {
+		operator = "matches"
+	}
+
+	action := r.Action
+	if r.Tag.Valid {
+		action += " " + r.Tag.String
+	}
+
+	return fmt.Sprintf("%s %s %q -> %s", r.Field, operator, r.Pattern, action)
+}
+
+func (r filterRule) apply(ctx context.Context, db *database.Queries, postID uuid.UUID) error {
+	switch r.Action {
+	case "hide":
+		return db.HidePost(ctx, database.HidePostParams{UserID: r.UserID, PostID: postID})
+	case "read":
+		return db.MarkPostRead(ctx, database.MarkPostReadParams{UserID: r.UserID, PostID: postID})
+	case "star":
+		return db.StarPost(ctx, database.StarPostParams{UserID: r.UserID, PostID: postID})
+	case "tag":
+		return db.TagPost(ctx, database.TagPostParams{UserID: r.UserID, PostID: postID, Tag: r.Tag.String})
+	}
+	return fmt.Errorf("unknown rule action %q", r.Action)
+}
+
+// applyRules runs every rule matching subject on the post. Rules belong to
+// different users, each only changes the state of the post for its owner.
+func applyRules(ctx context.Context, db *database.Queries, rules []filterRule, postID uuid.UUID, subject ruleSubject) error {
+	for _, rule := range rules {
+		if !rule.matches(subject) {
+			continue
+		}
+
+		err := rule.apply(ctx, db, postID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// selectRules returns all the rules of the user, or the one whose id is
+// given.
+func selectRules(s *state, user database.User, args []string) ([]filterRule, error) {
+	rules, err := s.db.GetFilterRulesForUser(context.Background(), user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(args) == 0 {
+		return compileRules(rules), nil
+	}
+
+	id, err := uuid.Parse(args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	for _, rule := range rules {
+		if rule.ID == id {
+			compiled, err := compileRule(rule)
+			if err != nil {
+				return nil, err
+			}
+			return []filterRule{compiled}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no rule %s", id)
+}
+
+func handlerRulesAdd(s *state, args []string, user database.User) error {
+	fs := flag.NewFlagSet("rules add", flag.ContinueOnError)
+	isRegex := fs.Bool("regex", false, "treat the pattern as a regular expression instead of a substring")
+	args, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+
+	if len(args) < 3 {
+		return errors.New("not enough arguments. needs field, pattern and action")
+	}
+
+	field, pattern, action := args[0], args[1], args[2]
+	if !slices.Contains(ruleFields, field) {
+		return fmt.Errorf("unknown field %q. use one of %s", field, strings.Join(ruleFields, ", "))
+	}
+	if !slices.Contains(ruleActions, action) {
+		return fmt.Errorf("unknown action %q. use one of %s", action, strings.Join(ruleActions, ", "))
+	}
+
+	params := database.CreateFilterRuleParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		UserID:    user.ID,
+		Field:     field,
+		Pattern:   pattern,
+		IsRegex:   *isRegex,
+		Action:    action,
+	}
+
+	if action == "tag" {
+		if len(args) < 4 {
+			return errors.New("not enough arguments. the tag action needs a tag")
+		}
+		params.Tag = sql.NullString{String: args[3], Valid: true}
+	}
+
+	if *isRegex {
+		_, err = regexp.Compile(pattern)
+		if err != nil {
+			return err
+		}
+	}
+
+	rule, err := s.db.CreateFilterRule(context.Background(), params)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Created rule %s: %s\n", rule.ID, filterRule{FilterRule: rule})
+
+	return nil
+}
+
+func handlerRulesList(s *state, user database.User) error {
+	rules, err := s.db.GetFilterRulesForUser(context.Background(), user.ID)
+	if err != nil {
+		return err
+	}
+
+	if len(rules) == 0 {
+		fmt.Println("No rules")
+		return nil
+	}
+
+	for _, rule := range rules {
+		fmt.Printf("%s - %s\n", rule.ID, filterRule{FilterRule: rule})
+	}
+
+	return nil
+}
+
+func handlerRulesDelete(s *state, args []string, user database.User) error {
+	if len(args) < 1 {
+		return errors.New("not enough arguments. needs rule id")
+	}
+
+	id, err := uuid.Parse(args[0])
+	if err != nil {
+		return err
+	}
+
+	deleted, err := s.db.DeleteFilterRule(context.Background(), database.DeleteFilterRuleParams{
+		ID:     id,
+		UserID: user.ID,
+	})
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return fmt.Errorf("no rule %s", id)
+	}
+
+	fmt.Printf("Deleted rule %s\n", id)
+
+	return nil
+}
+
+// handlerRulesTest lists the collected posts a rule would act on, without
+// changing anything.
+func handlerRulesTest(s *state, args []string, user database.User) error {
+	rules, err := selectRules(s, user, args)
+	if err != nil {
+		return err
+	}
+
+	posts, err := s.db.GetFollowedPostsForUser(context.Background(), user.ID)
+	if err != nil {
+		return err
+	}
+
+	categories, err := followedPostCategories(context.Background(), s.db, user)
+	if err != nil {
+		return err
+	}
+
+	for _, rule := range rules {
+		fmt.Printf("%s - %s\n", rule.ID, rule)
+		matched := 0
+		for _, post := range posts {
+			if rule.matches(postRuleSubject(post, categories[post.ID])) {
+				fmt.Printf("  * %s\n", post.Title)
+				matched++
+			}
+		}
+		fmt.Printf("  %d posts matched\n", matched)
+	}
+
+	return nil
+}
+
+// handlerRulesApply runs rules on the posts that were collected before
+// the rules existed.
+func handlerRulesApply(s *state, args []string, user database.User) error {
+	rules, err := selectRules(s, user, args)
+	if err != nil {
+		return err
+	}
+
+	posts, err := s.db.GetFollowedPostsForUser(context.Background(), user.ID)
+	if err != nil {
+		return err
+	}
+
+	categories, err := followedPostCategories(context.Background(), s.db, user)
+	if err != nil {
+		return err
+	}
+
+	matched := 0
+	for _, post := range posts {
+		subject := postRuleSubject(post, categories[post.ID])
+		if !slices.ContainsFunc(rules, func(rule filterRule) bool { return rule.matches(subject) }) {
+			continue
+		}
+
+		err = applyRules(context.Background(), s.db, rules, post.ID, subject)
+		if err != nil {
+			return err
+		}
+		matched++
+	}
+
+	fmt.Printf("Applied %d rules to %d posts\n", len(rules), matched)
+
+	return nil
+}
+
+func handlerRules(s *state, cmd command, user database.User) error {
+	if len(cmd.args) < 1 {
+		return errors.New("usage: rules add|list|test|apply|delete")
+	}
+
+	switch cmd.args[0] {
+	case "add":
+		return handlerRulesAdd(s, cmd.args[1:], user)
+	case "list":
+		return handlerRulesList(s, user)
+	case "test":
+		return handlerRulesTest(s, cmd.args[1:], user)
+	case "apply":
+		return handlerRulesApply(s, cmd.args[1:], user)
+	case "delete":
+		return handlerRulesDelete(s, cmd.args[1:], user)
+	}
+
+	return fmt.Errorf("unknown rules command %q. use add, list, test, apply or delete", cmd.args[0])
+}
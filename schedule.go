@@ -0,0 +1,110 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	minFetchInterval     = 15 * time.Minute
+	maxFetchInterval     = 24 * time.Hour
+	defaultFetchInterval = time.Hour
+	// observedPostsWindow is how many of the newest items are used to guess
+	// how often a feed publishes.
+	observedPostsWindow = 10
+)
+
+// syndicationPeriods maps sy:updatePeriod values to their length.
+var syndicationPeriods = map[string]time.Duration{
+	"hourly":  time.Hour,
+	"daily":   24 * time.Hour,
+	"weekly":  7 * 24 * time.Hour,
+	"monthly": 30 * 24 * time.Hour,
+	"yearly":  365 * 24 * time.Hour,
+}
+
+// observedInterval returns half the average gap between the newest posts,
+// so a feed is polled about twice for every post it publishes.
+func observedInterval(publishedAt []time.Time) time.Duration {
+	if len(publishedAt) < 2 {
+		return defaultFetchInterval
+	}
+
+	dates := slices.Clone(publishedAt)
+	slices.SortFunc(dates, func(a, b time.Time) int {
+		return b.Compare(a)
+	})
+	if len(dates) > observedPostsWindow {
+		dates = dates[:observedPostsWindow]
+	}
+
+	span := dates[0].Sub(dates[len(dates)-1])
+	return span / time.Duration(len(dates)-1) / 2
+}
+
+// publisherInterval is the shortest polling interval the feed asks for
+// through <ttl> or the syndication module, or zero if it does not say.
+func publisherInterval(feed *RSSFeed) time.Duration {
+	interval := time.Duration(feed.Channel.TTL) * time.Minute
+
+	period, ok := syndicationPeriods[strings.ToLower(strings.TrimSpace(feed.Channel.UpdatePeriod))]
+	if ok {
+		frequency := max(feed.Channel.UpdateFrequency, 1)
+		interval = max(interval, period/time.Duration(frequency))
+	}
+
+	return interval
+}
+
+func clampFetchInterval(interval time.Duration) time.Duration {
+	return min(max(interval, minFetchInterval), maxFetchInterval)
+}
+
+// skipped reports whether the feed asked not to be read at t through
+// <skipHours> or <skipDays>. Both are expressed in GMT.
+func skipped(feed *RSSFeed, t time.Time) bool {
+	t = t.UTC()
+	if slices.Contains(feed.Channel.SkipHours, t.Hour()) {
+		return true
+	}
+
+	for _, day := range feed.Channel.SkipDays {
+		if strings.EqualFold(strings.TrimSpace(day), t.Weekday().String()) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// scheduleNextFetch decides when a feed should be fetched again from its
+// posting history and the hints it publishes, bounded by minFetchInterval
+// and maxFetchInterval.
+func scheduleNextFetch(now time.Time, feed *RSSFeed, publishedAt []time.Time) (time.Time, time.Duration) {
+	interval := observedInterval(publishedAt)
+	interval = clampFetchInterval(max(interval, publisherInterval(feed)))
+
+	next := now.Add(interval)
+	// A week of hours is enough to get past any combination of skip rules.
+	for range 7 * 24 {
+		if !skipped(feed, next) {
+			break
+		}
+		next = next.Truncate(time.Hour).Add(time.Hour)
+	}
+
+	return next, interval
+}
+
+// failureBackoff doubles the wait after each consecutive failure.
+func failureBackoff(failures int32) time.Duration {
+	interval := minFetchInterval
+	for range failures {
+		interval *= 2
+		if interval >= maxFetchInterval {
+			return maxFetchInterval
+		}
+	}
+	return interval
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/alpsilva/go-blog-aggregator.git/internal/database"
+)
+
+var markupPattern = regexp.MustCompile(`<[^>]*>`)
+
+// cleanSnippet drops the HTML that ts_headline keeps from descriptions and
+// puts the snippet on a single line.
+func cleanSnippet(snippet string) string {
+	snippet = markupPattern.ReplaceAllString(snippet, " ")
+	return strings.Join(strings.Fields(snippet), " ")
+}
+
+func parseDateFlag(value string) (sql.NullTime, error) {
+	if value == "" {
+		return sql.NullTime{}, nil
+	}
+
+	date, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return sql.NullTime{}, err
+	}
+
+	return sql.NullTime{Time: date, Valid: true}, nil
+}
+
+func handlerSearch(s *state, cmd command, user database.User) error {
+	fs := flag.NewFlagSet("search", flag.ContinueOnError)
+	feedURL := fs.String("feed", "", "only search posts of this feed")
+	since := fs.String("since", "", "only search posts published on or after this date (YYYY-MM-DD)")
+	until := fs.String("until", "", "only search posts published before this date (YYYY-MM-DD)")
+	author := fs.String("author", "", "only search posts whose author contains this")
+	category := fs.String("category", "", "only search posts in this category")
+	postTag := fs.String("post-tag", "", "only search posts a rule tagged with this")
+	limit := fs.Int("limit", 10, "maximum number of results")
+	args, err := parseArgs(fs, cmd.args)
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		return errors.New("not enough arguments. needs query")
+	}
+
+	params := database.SearchPostsForUserParams{
+		Query:      strings.Join(args, " "),
+		UserID:     user.ID,
+		FeedUrl:    sql.NullString{String: *feedURL, Valid: *feedURL != ""},
+		Author:     sql.NullString{String: *author, Valid: *author != ""},
+		Category:   sql.NullString{String: *category, Valid: *category != ""},
+		PostTag:    sql.NullString{String: *postTag, Valid: *postTag != ""},
+		MaxResults: int32(*limit),
+	}
+
+	params.Since, err = parseDateFlag(*since)
+	if err != nil {
+		return err
+	}
+	params.Until, err = parseDateFlag(*until)
+	if err != nil {
+		return err
+	}
+
+	results, err := s.db.SearchPostsForUser(context.Background(), params)
+	if err != nil {
+		return err
+	}
+
+	if len(results) == 0 {
+		fmt.Println("No posts found")
+		return nil
+	}
+
+	output := ""
+	for i, result := range results {
+		output += fmt.Sprintf("%d - %s (%s)\n", i+1, result.Title, result.ID)
+		output += fmt.Sprintf("    %s, %s", result.FeedName, result.PublishedAt.Format(time.DateOnly))
+		if result.Author.Valid {
+			output += fmt.Sprintf(", by %s", result.Author.String)
+		}
+		output += "\n"
+		output += fmt.Sprintf("    %s\n", cleanSnippet(result.Snippet))
+	}
+
+	fmt.Println(output)
+
+	return nil
+}
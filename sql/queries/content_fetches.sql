@@ -0,0 +1,54 @@
+-- name: CreateContentFetch :execrows
+INSERT INTO content_fetches (post_id, created_at, updated_at, next_attempt_at)
+SELECT p.id, NOW(), NOW(), NOW()
+FROM posts p
+JOIN feeds f ON f.id = p.feed_id
+WHERE p.id = $1
+AND f.fetch_full_content
+ON CONFLICT (post_id) DO NOTHING;
+
+-- name: ClaimContentFetches :many
+UPDATE content_fetches c
+SET
+updated_at = NOW(),
+next_attempt_at = @lease_until
+FROM posts p
+WHERE c.post_id IN (
+    SELECT post_id
+    FROM content_fetches
+    WHERE fetched_at IS NULL
+    AND attempts < @max_attempts
+    AND next_attempt_at <= NOW()
+    ORDER BY next_attempt_at ASC
+    LIMIT @max_fetches
+    FOR UPDATE SKIP LOCKED
+)
+AND p.id = c.post_id
+RETURNING c.post_id, c.attempts, p.title, p.url;
+
+-- name: MarkContentFetched :exec
+WITH fetched AS (
+    UPDATE content_fetches
+    SET
+    updated_at = NOW(),
+    attempts = attempts + 1,
+    last_error = NULL,
+    fetched_at = NOW()
+    WHERE content_fetches.post_id = @post_id
+    RETURNING content_fetches.post_id
+)
+UPDATE posts
+SET
+updated_at = NOW(),
+content = @content
+FROM fetched
+WHERE posts.id = fetched.post_id;
+
+-- name: RecordContentFetchFailure :exec
+UPDATE content_fetches
+SET
+updated_at = NOW(),
+attempts = attempts + 1,
+last_error = $2,
+next_attempt_at = $3
+WHERE post_id = $1;
@@ -22,8 +22,15 @@ AND ff.feed_id = $2;
 
 
 -- name: GetFeedFollowsForUser :many
-SELECT u.name AS user_name, f.*
+SELECT u.name AS user_name, f.*, (
+    SELECT COUNT(*)
+    FROM posts p
+    LEFT JOIN post_states ps ON ps.post_id = p.id AND ps.user_id = ff.user_id
+    WHERE p.feed_id = f.id
+    AND ps.read_at IS NULL
+    AND ps.hidden_at IS NULL
+) AS unread_count
 FROM feed_follows ff
 INNER JOIN users u ON ff.user_id = u.id
 INNER JOIN feeds f ON ff.feed_id = f.id
-WHERE ff.user_id = $1;
\ No newline at end of file
+WHERE ff.user_id = $1;
@@ -15,19 +15,110 @@ SELECT *
 FROM feeds
 WHERE feeds.url = $1;
 
+-- name: GetFeedById :one
+SELECT *
+FROM feeds
+WHERE feeds.id = $1;
+
 -- name: GetFeeds :many
 SELECT *
 FROM feeds;
 
--- name: MarkFeedFetched :exec
+-- name: ClaimFeedsToFetch :many
+UPDATE feeds
+SET
+updated_at = NOW(),
+last_fetched_at = NOW(),
+next_fetch_at = @lease_until::timestamp,
+leased_until = @lease_until::timestamp
+WHERE id IN (
+    SELECT id
+    FROM feeds
+    WHERE NOT disabled
+    AND (next_fetch_at IS NULL OR next_fetch_at <= NOW())
+    ORDER BY next_fetch_at ASC NULLS FIRST, last_fetched_at ASC NULLS FIRST
+    LIMIT @max_feeds
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: ClaimFeed :one
 UPDATE feeds
 SET
 updated_at = NOW(),
-last_fetched_at = NOW()
+last_fetched_at = NOW(),
+next_fetch_at = @lease_until::timestamp,
+leased_until = @lease_until::timestamp
+WHERE id = (
+    SELECT id
+    FROM feeds
+    WHERE feeds.id = @id
+    AND NOT disabled
+    AND (leased_until IS NULL OR leased_until <= NOW())
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: UpdateFeedCacheHeaders :exec
+UPDATE feeds
+SET
+updated_at = NOW(),
+etag = $2,
+last_modified = $3
 WHERE id = $1;
 
--- name: GetNextFeedToFetch :one
-SELECT *
-FROM feeds
-ORDER BY last_fetched_at ASC NULLS FIRST
-LIMIT 1;
+-- name: RecordFeedSuccess :exec
+UPDATE feeds
+SET
+updated_at = NOW(),
+last_error = NULL,
+failure_count = 0,
+last_success_at = NOW()
+WHERE id = $1;
+
+-- name: RecordFeedFailure :one
+UPDATE feeds
+SET
+updated_at = NOW(),
+last_error = @last_error,
+failure_count = failure_count + 1,
+disabled = failure_count + 1 > @max_failures::int
+WHERE id = @id
+RETURNING *;
+
+-- name: EnableFeed :one
+UPDATE feeds
+SET
+updated_at = NOW(),
+disabled = FALSE,
+failure_count = 0,
+last_error = NULL
+WHERE url = $1
+RETURNING *;
+
+-- name: ScheduleFeedFetch :exec
+UPDATE feeds
+SET
+updated_at = NOW(),
+next_fetch_at = $2,
+fetch_interval_seconds = $3,
+leased_until = NULL
+WHERE id = $1;
+
+-- name: UpdateFeedMetadata :exec
+UPDATE feeds
+SET
+updated_at = NOW(),
+description = $2,
+site_url = $3,
+language = $4,
+image_url = $5
+WHERE id = $1;
+
+-- name: SetFeedFetchFullContent :one
+UPDATE feeds
+SET
+updated_at = NOW(),
+fetch_full_content = $2
+WHERE url = $1
+RETURNING *;
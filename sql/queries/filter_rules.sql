@@ -0,0 +1,31 @@
+-- name: CreateFilterRule :one
+INSERT INTO filter_rules (id, created_at, updated_at, user_id, field, pattern, is_regex, action, tag)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7,
+    $8,
+    $9
+)
+RETURNING *;
+
+-- name: GetFilterRulesForUser :many
+SELECT *
+FROM filter_rules
+WHERE user_id = $1
+ORDER BY created_at;
+
+-- name: GetFilterRulesForFeed :many
+SELECT r.*
+FROM filter_rules r
+INNER JOIN feed_follows ff ON ff.user_id = r.user_id
+WHERE ff.feed_id = $1
+ORDER BY r.created_at;
+
+-- name: DeleteFilterRule :execrows
+DELETE FROM filter_rules
+WHERE id = $1 AND user_id = $2;
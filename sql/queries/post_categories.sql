@@ -0,0 +1,18 @@
+-- name: AddPostCategory :exec
+INSERT INTO post_categories (post_id, name, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT (post_id, name) DO NOTHING;
+
+-- name: GetPostCategories :many
+SELECT name
+FROM post_categories
+WHERE post_id = $1
+ORDER BY name;
+
+-- name: GetFollowedPostCategoriesForUser :many
+SELECT pc.post_id, pc.name
+FROM post_categories pc
+INNER JOIN posts p ON p.id = pc.post_id
+INNER JOIN feed_follows ff ON ff.feed_id = p.feed_id
+WHERE ff.user_id = $1
+ORDER BY pc.name;
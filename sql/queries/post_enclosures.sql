@@ -0,0 +1,22 @@
+-- name: UpsertPostEnclosure :exec
+INSERT INTO post_enclosures (id, created_at, updated_at, post_id, url, mime_type, length)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7
+)
+ON CONFLICT (post_id, url) DO UPDATE
+SET
+updated_at = EXCLUDED.updated_at,
+mime_type = EXCLUDED.mime_type,
+length = EXCLUDED.length;
+
+-- name: GetPostEnclosures :many
+SELECT *
+FROM post_enclosures
+WHERE post_id = $1
+ORDER BY created_at;
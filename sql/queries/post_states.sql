@@ -0,0 +1,47 @@
+-- name: MarkPostRead :exec
+INSERT INTO post_states (user_id, post_id, created_at, updated_at, read_at)
+SELECT @user_id::uuid, p.id, NOW(), NOW(), NOW()
+FROM posts p
+INNER JOIN feed_follows ff ON ff.feed_id = p.feed_id
+WHERE ff.user_id = @user_id::uuid
+AND p.id = @post_id::uuid
+ON CONFLICT (user_id, post_id) DO UPDATE
+SET
+updated_at = NOW(),
+read_at = COALESCE(post_states.read_at, NOW());
+
+-- name: MarkPostsRead :execrows
+INSERT INTO post_states (user_id, post_id, created_at, updated_at, read_at)
+SELECT @user_id::uuid, p.id, NOW(), NOW(), NOW()
+FROM posts p
+INNER JOIN feed_follows ff ON ff.feed_id = p.feed_id
+WHERE ff.user_id = @user_id::uuid
+AND (sqlc.narg('feed_id')::uuid IS NULL OR p.feed_id = sqlc.narg('feed_id')::uuid)
+AND (sqlc.narg('before')::timestamp IS NULL OR p.published_at < sqlc.narg('before')::timestamp)
+ON CONFLICT (user_id, post_id) DO UPDATE
+SET
+updated_at = NOW(),
+read_at = COALESCE(post_states.read_at, NOW());
+
+-- name: HidePost :exec
+INSERT INTO post_states (user_id, post_id, created_at, updated_at, hidden_at)
+VALUES ($1, $2, NOW(), NOW(), NOW())
+ON CONFLICT (user_id, post_id) DO UPDATE
+SET
+updated_at = NOW(),
+hidden_at = COALESCE(post_states.hidden_at, NOW());
+
+-- name: StarPost :exec
+INSERT INTO post_states (user_id, post_id, created_at, updated_at, starred_at)
+VALUES ($1, $2, NOW(), NOW(), NOW())
+ON CONFLICT (user_id, post_id) DO UPDATE
+SET
+updated_at = NOW(),
+starred_at = COALESCE(post_states.starred_at, NOW());
+
+-- name: UnstarPost :exec
+UPDATE post_states
+SET
+updated_at = NOW(),
+starred_at = NULL
+WHERE user_id = $1 AND post_id = $2;
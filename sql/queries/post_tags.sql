@@ -0,0 +1,10 @@
+-- name: TagPost :exec
+INSERT INTO post_tags (user_id, post_id, tag, created_at)
+VALUES ($1, $2, $3, NOW())
+ON CONFLICT (user_id, post_id, tag) DO NOTHING;
+
+-- name: GetPostTags :many
+SELECT tag
+FROM post_tags
+WHERE user_id = $1 AND post_id = $2
+ORDER BY tag;
@@ -1,5 +1,105 @@
--- name: CreatePost :one
-INSERT INTO posts (id, created_at, updated_at, title, url, description, published_at, feed_id)
+-- name: GetDigestPostsForUser :many
+SELECT p.*, f.name AS feed_name
+FROM posts p
+INNER JOIN feed_follows ff ON ff.feed_id = p.feed_id
+INNER JOIN feeds f ON f.id = p.feed_id
+WHERE ff.user_id = @user_id
+AND p.created_at > @since
+AND p.created_at <= @until
+AND NOT EXISTS (
+    SELECT 1
+    FROM post_states ps
+    WHERE ps.user_id = ff.user_id AND ps.post_id = p.id AND ps.hidden_at IS NOT NULL
+)
+ORDER BY f.name, p.published_at DESC;
+
+-- name: GetFollowedPostsForUser :many
+SELECT p.*
+FROM posts p
+INNER JOIN feed_follows ff ON ff.feed_id = p.feed_id
+WHERE ff.user_id = $1
+ORDER BY p.published_at DESC;
+
+-- name: GetPostForUser :one
+SELECT *
+FROM posts
+WHERE posts.id = $1
+AND EXISTS (
+    SELECT 1
+    FROM feed_follows ff
+    WHERE ff.feed_id = posts.feed_id AND ff.user_id = $2
+);
+
+-- name: GetTimelineForUser :many
+SELECT p.*, f.name AS feed_name, f.url AS feed_url, ps.read_at, ps.starred_at
+FROM posts p
+INNER JOIN feed_follows ff ON ff.feed_id = p.feed_id
+INNER JOIN feeds f ON f.id = p.feed_id
+LEFT JOIN post_states ps ON ps.post_id = p.id AND ps.user_id = ff.user_id
+WHERE ff.user_id = @user_id
+AND (sqlc.narg('feed_url')::text IS NULL OR f.url = sqlc.narg('feed_url')::text)
+AND (sqlc.narg('tag')::text IS NULL OR EXISTS (
+    SELECT 1
+    FROM feed_follow_tags fft
+    INNER JOIN tags t ON t.id = fft.tag_id
+    WHERE fft.feed_follow_id = ff.id AND t.name = sqlc.narg('tag')::text
+))
+AND (sqlc.narg('since')::timestamp IS NULL OR p.published_at >= sqlc.narg('since')::timestamp)
+AND (sqlc.narg('until')::timestamp IS NULL OR p.published_at < sqlc.narg('until')::timestamp)
+AND (NOT @unread_only::boolean OR ps.read_at IS NULL)
+AND ps.hidden_at IS NULL
+AND (sqlc.narg('after')::uuid IS NULL OR (p.published_at, p.id) < (
+    SELECT ap.published_at, ap.id
+    FROM posts ap
+    WHERE ap.id = sqlc.narg('after')::uuid
+))
+AND (sqlc.narg('post_tag')::text IS NULL OR EXISTS (
+    SELECT 1
+    FROM post_tags pt
+    WHERE pt.user_id = ff.user_id AND pt.post_id = p.id AND pt.tag = sqlc.narg('post_tag')::text
+))
+ORDER BY p.published_at DESC, p.id DESC
+LIMIT @max_posts;
+
+-- name: SearchPostsForUser :many
+SELECT p.id, p.title, p.url, p.published_at, p.author, f.name AS feed_name,
+    ts_rank(p.search_vector, query)::real AS rank,
+    ts_headline(
+        'english',
+        p.title || ' ' || coalesce(p.description, ''),
+        query,
+        'StartSel=**, StopSel=**, MaxFragments=2, MaxWords=20, MinWords=8'
+    )::text AS snippet
+FROM posts p
+INNER JOIN feed_follows ff ON ff.feed_id = p.feed_id
+INNER JOIN feeds f ON f.id = p.feed_id
+CROSS JOIN websearch_to_tsquery('english', @query::text) query
+WHERE ff.user_id = @user_id
+AND p.search_vector @@ query
+AND NOT EXISTS (
+    SELECT 1
+    FROM post_states ps
+    WHERE ps.user_id = ff.user_id AND ps.post_id = p.id AND ps.hidden_at IS NOT NULL
+)
+AND (sqlc.narg('feed_url')::text IS NULL OR f.url = sqlc.narg('feed_url')::text)
+AND (sqlc.narg('since')::timestamp IS NULL OR p.published_at >= sqlc.narg('since')::timestamp)
+AND (sqlc.narg('until')::timestamp IS NULL OR p.published_at < sqlc.narg('until')::timestamp)
+AND (sqlc.narg('author')::text IS NULL OR p.author ILIKE '%' || sqlc.narg('author')::text || '%')
+AND (sqlc.narg('category')::text IS NULL OR EXISTS (
+    SELECT 1
+    FROM post_categories pc
+    WHERE pc.post_id = p.id AND lower(pc.name) = lower(sqlc.narg('category')::text)
+))
+AND (sqlc.narg('post_tag')::text IS NULL OR EXISTS (
+    SELECT 1
+    FROM post_tags pt
+    WHERE pt.user_id = ff.user_id AND pt.post_id = p.id AND pt.tag = sqlc.narg('post_tag')::text
+))
+ORDER BY rank DESC, p.published_at DESC
+LIMIT @max_results;
+
+-- name: UpsertPost :one
+INSERT INTO posts (id, created_at, updated_at, title, url, description, published_at, feed_id, guid, content, author, comments_url)
 VALUES (
     $1,
     $2,
@@ -8,14 +108,19 @@ VALUES (
     $5,
     $6,
     $7,
-    $8
+    $8,
+    $9,
+    $10,
+    $11,
+    $12
 )
-RETURNING *;
-
--- name: GetPostsForUser :many
-SELECT p.*
-FROM posts p
-JOIN feeds f ON p.feed_id = f.id
-WHERE f.user_id = $1
-ORDER BY p.published_at DESC
-LIMIT $2;
\ No newline at end of file
+ON CONFLICT (feed_id, guid) DO UPDATE
+SET
+updated_at = EXCLUDED.updated_at,
+title = EXCLUDED.title,
+url = EXCLUDED.url,
+description = EXCLUDED.description,
+content = COALESCE(EXCLUDED.content, posts.content),
+author = EXCLUDED.author,
+comments_url = EXCLUDED.comments_url
+RETURNING *, (xmax = 0) AS inserted;
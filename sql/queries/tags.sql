@@ -0,0 +1,57 @@
+-- name: CreateTag :one
+INSERT INTO tags (id, created_at, updated_at, user_id, name)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5
+)
+RETURNING *;
+
+-- name: GetTagByName :one
+SELECT *
+FROM tags
+WHERE user_id = $1 AND name = $2;
+
+-- name: GetTagsForUser :many
+SELECT t.*, COUNT(fft.feed_follow_id) AS feed_count
+FROM tags t
+LEFT JOIN feed_follow_tags fft ON fft.tag_id = t.id
+WHERE t.user_id = $1
+GROUP BY t.id
+ORDER BY t.name;
+
+-- name: RenameTag :execrows
+UPDATE tags
+SET
+updated_at = NOW(),
+name = @new_name
+WHERE user_id = @user_id AND name = @name;
+
+-- name: DeleteTag :execrows
+DELETE FROM tags
+WHERE user_id = $1 AND name = $2;
+
+-- name: TagFeedFollow :execrows
+INSERT INTO feed_follow_tags (feed_follow_id, tag_id, created_at)
+SELECT ff.id, @tag_id, NOW()
+FROM feed_follows ff
+WHERE ff.user_id = @user_id AND ff.feed_id = @feed_id
+ON CONFLICT (feed_follow_id, tag_id) DO NOTHING;
+
+-- name: UntagFeedFollow :execrows
+DELETE FROM feed_follow_tags fft
+USING feed_follows ff
+WHERE fft.feed_follow_id = ff.id
+AND ff.user_id = @user_id
+AND ff.feed_id = @feed_id
+AND fft.tag_id = @tag_id;
+
+-- name: GetFeedFollowTagsForUser :many
+SELECT ff.feed_id, t.name
+FROM feed_follow_tags fft
+INNER JOIN feed_follows ff ON ff.id = fft.feed_follow_id
+INNER JOIN tags t ON t.id = fft.tag_id
+WHERE ff.user_id = $1
+ORDER BY t.name;
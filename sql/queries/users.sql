@@ -1,10 +1,12 @@
 -- name: CreateUser :one
-INSERT INTO users (id, created_at, updated_at, name)
+INSERT INTO users (id, created_at, updated_at, name, api_key, feed_token)
 VALUES (
     $1,
     $2,
     $3,
-    $4
+    $4,
+    $5,
+    $6
 )
 RETURNING *;
 
@@ -14,6 +16,18 @@ FROM users
 WHERE users.name = $1
 LIMIT 1;
 
+-- name: GetUserByAPIKey :one
+SELECT *
+FROM users
+WHERE users.api_key = $1
+LIMIT 1;
+
+-- name: GetUserByFeedToken :one
+SELECT *
+FROM users
+WHERE users.feed_token = $1
+LIMIT 1;
+
 -- name: GetUserById :one
 SELECT *
 FROM users
@@ -24,5 +38,21 @@ LIMIT 1;
 SELECT *
 FROM users;
 
+-- name: GetUsersDueForDigest :many
+SELECT *
+FROM users
+WHERE users.email IS NOT NULL
+AND (users.last_digest_at IS NULL OR users.last_digest_at <= $1);
+
+-- name: MarkDigestSent :exec
+UPDATE users
+SET last_digest_at = $2, updated_at = $2
+WHERE users.id = $1;
+
 -- name: ResetUsers :exec
-DELETE FROM users;
\ No newline at end of file
+DELETE FROM users;
+
+-- name: SetUserEmail :exec
+UPDATE users
+SET email = $2, updated_at = NOW()
+WHERE users.id = $1;
@@ -0,0 +1,92 @@
+-- name: CreateWebhook :one
+INSERT INTO webhooks (id, created_at, updated_at, user_id, feed_id, keyword, url, secret)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7,
+    $8
+)
+RETURNING *;
+
+-- name: GetWebhooksForUser :many
+SELECT w.*, f.url AS feed_url
+FROM webhooks w
+LEFT JOIN feeds f ON f.id = w.feed_id
+WHERE w.user_id = $1
+ORDER BY w.created_at;
+
+-- name: DeleteWebhook :execrows
+DELETE FROM webhooks
+WHERE id = $1 AND user_id = $2;
+
+-- name: CreateWebhookDeliveries :execrows
+INSERT INTO webhook_deliveries (id, created_at, updated_at, webhook_id, post_id, next_attempt_at)
+SELECT gen_random_uuid(), NOW(), NOW(), w.id, p.id, NOW()
+FROM posts p
+INNER JOIN feed_follows ff ON ff.feed_id = p.feed_id
+INNER JOIN webhooks w ON w.user_id = ff.user_id
+WHERE p.id = $1
+AND (w.feed_id IS NULL OR w.feed_id = p.feed_id)
+AND (w.keyword IS NULL OR p.title ILIKE '%' || w.keyword || '%' OR p.description ILIKE '%' || w.keyword || '%')
+AND NOT EXISTS (
+    SELECT 1
+    FROM post_states ps
+    WHERE ps.user_id = w.user_id AND ps.post_id = p.id AND ps.hidden_at IS NOT NULL
+)
+ON CONFLICT (webhook_id, post_id) DO NOTHING;
+
+-- name: ClaimWebhookDeliveries :many
+UPDATE webhook_deliveries d
+SET
+updated_at = NOW(),
+next_attempt_at = @lease_until
+FROM webhooks w, posts p, feeds f
+WHERE d.id IN (
+    SELECT id
+    FROM webhook_deliveries
+    WHERE delivered_at IS NULL
+    AND attempts < @max_attempts
+    AND next_attempt_at <= NOW()
+    ORDER BY next_attempt_at ASC
+    LIMIT @max_deliveries
+    FOR UPDATE SKIP LOCKED
+)
+AND w.id = d.webhook_id
+AND p.id = d.post_id
+AND f.id = p.feed_id
+RETURNING d.id, d.attempts, w.url AS webhook_url, w.secret,
+    p.id AS post_id, p.title, p.url, p.description, p.published_at, p.guid,
+    f.id AS feed_id, f.name AS feed_name, f.url AS feed_url;
+
+-- name: MarkWebhookDelivered :exec
+UPDATE webhook_deliveries
+SET
+updated_at = NOW(),
+attempts = attempts + 1,
+status_code = $2,
+last_error = NULL,
+delivered_at = NOW()
+WHERE id = $1;
+
+-- name: RecordWebhookFailure :exec
+UPDATE webhook_deliveries
+SET
+updated_at = NOW(),
+attempts = attempts + 1,
+status_code = $2,
+last_error = $3,
+next_attempt_at = $4
+WHERE id = $1;
+
+-- name: GetWebhookDeliveriesForUser :many
+SELECT d.*, w.url AS webhook_url, p.title AS post_title
+FROM webhook_deliveries d
+INNER JOIN webhooks w ON w.id = d.webhook_id
+INNER JOIN posts p ON p.id = d.post_id
+WHERE w.user_id = $1
+ORDER BY d.created_at DESC
+LIMIT $2;
@@ -0,0 +1,49 @@
+-- name: UpsertWebSubHub :exec
+INSERT INTO websub_subscriptions (id, created_at, updated_at, feed_id, hub_url, topic_url, secret)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7
+)
+ON CONFLICT (feed_id) DO UPDATE
+SET
+updated_at = EXCLUDED.updated_at,
+hub_url = EXCLUDED.hub_url,
+topic_url = EXCLUDED.topic_url,
+secret = EXCLUDED.secret,
+requested_at = NULL,
+lease_expires_at = NULL;
+
+-- name: GetWebSubSubscription :one
+SELECT *
+FROM websub_subscriptions
+WHERE id = $1;
+
+-- name: GetWebSubSubscriptionByFeed :one
+SELECT *
+FROM websub_subscriptions
+WHERE feed_id = $1;
+
+-- name: GetWebSubSubscriptionsToRenew :many
+SELECT *
+FROM websub_subscriptions
+WHERE (lease_expires_at IS NULL OR lease_expires_at < @renew_before::timestamp)
+AND (requested_at IS NULL OR requested_at < @retry_before::timestamp);
+
+-- name: MarkWebSubRequested :exec
+UPDATE websub_subscriptions
+SET
+updated_at = NOW(),
+requested_at = NOW()
+WHERE id = $1;
+
+-- name: ConfirmWebSubSubscription :exec
+UPDATE websub_subscriptions
+SET
+updated_at = NOW(),
+lease_expires_at = $2
+WHERE id = $1;
@@ -0,0 +1,13 @@
+-- +goose Up
+ALTER TABLE feeds
+ADD COLUMN last_error TEXT NULL,
+ADD COLUMN failure_count INTEGER NOT NULL DEFAULT 0,
+ADD COLUMN last_success_at TIMESTAMP NULL,
+ADD COLUMN disabled BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- +goose Down
+ALTER TABLE feeds
+DROP COLUMN last_error,
+DROP COLUMN failure_count,
+DROP COLUMN last_success_at,
+DROP COLUMN disabled;
@@ -0,0 +1,6 @@
+-- +goose Up
+ALTER TABLE feed_follows
+ADD COLUMN category TEXT NULL;
+
+-- +goose Down
+ALTER TABLE feed_follows DROP COLUMN category;
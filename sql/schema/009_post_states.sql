@@ -0,0 +1,23 @@
+-- +goose Up
+CREATE TABLE post_states (
+    user_id UUID NOT NULL,
+    post_id UUID NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    read_at TIMESTAMP NULL,
+
+    PRIMARY KEY (user_id, post_id),
+
+    FOREIGN KEY ("user_id")
+        REFERENCES users("id")
+        ON UPDATE CASCADE
+        ON DELETE CASCADE,
+
+    FOREIGN KEY ("post_id")
+        REFERENCES posts("id")
+        ON UPDATE CASCADE
+        ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE post_states;
@@ -0,0 +1,20 @@
+-- +goose Up
+CREATE TABLE websub_subscriptions (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    feed_id UUID UNIQUE NOT NULL,
+    hub_url TEXT NOT NULL,
+    topic_url TEXT NOT NULL,
+    secret TEXT NOT NULL,
+    requested_at TIMESTAMP NULL,
+    lease_expires_at TIMESTAMP NULL,
+
+    FOREIGN KEY ("feed_id")
+        REFERENCES feeds("id")
+        ON UPDATE CASCADE
+        ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE websub_subscriptions;
@@ -0,0 +1,47 @@
+-- +goose Up
+CREATE TABLE webhooks (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL,
+    feed_id UUID NULL,
+    keyword TEXT NULL,
+    url TEXT NOT NULL,
+    secret TEXT NOT NULL,
+
+    FOREIGN KEY ("user_id")
+        REFERENCES users("id")
+        ON UPDATE CASCADE
+        ON DELETE CASCADE,
+    FOREIGN KEY ("feed_id")
+        REFERENCES feeds("id")
+        ON UPDATE CASCADE
+        ON DELETE CASCADE
+);
+
+CREATE TABLE webhook_deliveries (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    webhook_id UUID NOT NULL,
+    post_id UUID NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL,
+    status_code INTEGER NULL,
+    last_error TEXT NULL,
+    delivered_at TIMESTAMP NULL,
+
+    UNIQUE (webhook_id, post_id),
+    FOREIGN KEY ("webhook_id")
+        REFERENCES webhooks("id")
+        ON UPDATE CASCADE
+        ON DELETE CASCADE,
+    FOREIGN KEY ("post_id")
+        REFERENCES posts("id")
+        ON UPDATE CASCADE
+        ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE webhook_deliveries;
+DROP TABLE webhooks;
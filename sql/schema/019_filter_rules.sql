@@ -0,0 +1,49 @@
+-- +goose Up
+CREATE TABLE filter_rules (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL,
+    field TEXT NOT NULL,
+    pattern TEXT NOT NULL,
+    is_regex BOOLEAN NOT NULL DEFAULT FALSE,
+    action TEXT NOT NULL,
+    tag TEXT NULL,
+
+    FOREIGN KEY ("user_id")
+        REFERENCES users("id")
+        ON UPDATE CASCADE
+        ON DELETE CASCADE
+);
+
+ALTER TABLE post_states
+ADD COLUMN starred_at TIMESTAMP NULL,
+ADD COLUMN hidden_at TIMESTAMP NULL;
+
+CREATE TABLE post_tags (
+    user_id UUID NOT NULL,
+    post_id UUID NOT NULL,
+    tag TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+
+    PRIMARY KEY (user_id, post_id, tag),
+
+    FOREIGN KEY ("user_id")
+        REFERENCES users("id")
+        ON UPDATE CASCADE
+        ON DELETE CASCADE,
+
+    FOREIGN KEY ("post_id")
+        REFERENCES posts("id")
+        ON UPDATE CASCADE
+        ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE post_tags;
+
+ALTER TABLE post_states
+DROP COLUMN starred_at,
+DROP COLUMN hidden_at;
+
+DROP TABLE filter_rules;
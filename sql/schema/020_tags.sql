@@ -0,0 +1,60 @@
+-- +goose Up
+CREATE TABLE tags (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL,
+    name TEXT NOT NULL,
+
+    UNIQUE (user_id, name),
+    FOREIGN KEY ("user_id")
+        REFERENCES users("id")
+        ON UPDATE CASCADE
+        ON DELETE CASCADE
+);
+
+CREATE TABLE feed_follow_tags (
+    feed_follow_id UUID NOT NULL,
+    tag_id UUID NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+
+    PRIMARY KEY (feed_follow_id, tag_id),
+
+    FOREIGN KEY ("feed_follow_id")
+        REFERENCES feed_follows("id")
+        ON UPDATE CASCADE
+        ON DELETE CASCADE,
+
+    FOREIGN KEY ("tag_id")
+        REFERENCES tags("id")
+        ON UPDATE CASCADE
+        ON DELETE CASCADE
+);
+
+-- Categories imported from OPML become tags.
+INSERT INTO tags (id, created_at, updated_at, user_id, name)
+SELECT gen_random_uuid(), NOW(), NOW(), user_id, category
+FROM feed_follows
+WHERE category IS NOT NULL AND category <> ''
+GROUP BY user_id, category;
+
+INSERT INTO feed_follow_tags (feed_follow_id, tag_id, created_at)
+SELECT ff.id, t.id, NOW()
+FROM feed_follows ff
+INNER JOIN tags t ON t.user_id = ff.user_id AND t.name = ff.category;
+
+ALTER TABLE feed_follows DROP COLUMN category;
+
+-- +goose Down
+ALTER TABLE feed_follows ADD COLUMN category TEXT NULL;
+
+UPDATE feed_follows ff
+SET category = (
+    SELECT MIN(t.name)
+    FROM feed_follow_tags fft
+    INNER JOIN tags t ON t.id = fft.tag_id
+    WHERE fft.feed_follow_id = ff.id
+);
+
+DROP TABLE feed_follow_tags;
+DROP TABLE tags;
@@ -0,0 +1,42 @@
+-- +goose Up
+ALTER TABLE posts
+ADD COLUMN author TEXT NULL,
+ADD COLUMN comments_url TEXT NULL;
+
+CREATE TABLE post_categories (
+    post_id UUID NOT NULL,
+    name TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+
+    PRIMARY KEY (post_id, name),
+    FOREIGN KEY ("post_id")
+        REFERENCES posts("id")
+        ON UPDATE CASCADE
+        ON DELETE CASCADE
+);
+
+CREATE INDEX post_categories_name_idx ON post_categories (lower(name));
+
+CREATE TABLE post_enclosures (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    post_id UUID NOT NULL,
+    url TEXT NOT NULL,
+    mime_type TEXT NULL,
+    length BIGINT NULL,
+
+    UNIQUE (post_id, url),
+    FOREIGN KEY ("post_id")
+        REFERENCES posts("id")
+        ON UPDATE CASCADE
+        ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE post_enclosures;
+DROP TABLE post_categories;
+
+ALTER TABLE posts
+DROP COLUMN author,
+DROP COLUMN comments_url;
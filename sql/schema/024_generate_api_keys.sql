@@ -0,0 +1,12 @@
+-- +goose Up
+ALTER TABLE users ALTER COLUMN api_key DROP DEFAULT;
+
+-- Keys from the old random() default are predictable, so replace them.
+-- gen_random_uuid() draws from a cryptographic source, two of them give
+-- 244 random bits in the same 64 hex characters gator generates.
+UPDATE users
+SET api_key = replace(gen_random_uuid()::text || gen_random_uuid()::text, '-', ''),
+updated_at = NOW();
+
+-- +goose Down
+ALTER TABLE users ALTER COLUMN api_key SET DEFAULT encode(sha256(random()::text::bytea), 'hex');
@@ -0,0 +1,10 @@
+-- +goose Up
+ALTER TABLE users ALTER COLUMN feed_token DROP DEFAULT;
+
+-- Like the api keys, tokens from the old random() default are predictable.
+UPDATE users
+SET feed_token = replace(gen_random_uuid()::text || gen_random_uuid()::text, '-', ''),
+updated_at = NOW();
+
+-- +goose Down
+ALTER TABLE users ALTER COLUMN feed_token SET DEFAULT encode(sha256(random()::text::bytea), 'hex');
@@ -0,0 +1,9 @@
+-- +goose Up
+-- next_fetch_at doubles as the lease of a claimed feed, but a refresh asked
+-- for by hand ignores the schedule and needs to tell the two apart.
+ALTER TABLE feeds
+ADD COLUMN leased_until TIMESTAMP NULL;
+
+-- +goose Down
+ALTER TABLE feeds
+DROP COLUMN leased_until;
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/alpsilva/go-blog-aggregator.git/internal/database"
+	"github.com/google/uuid"
+)
+
+// ensureTag returns the tag of the user with that name, creating it if
+// needed.
+func ensureTag(ctx context.Context, db *database.Queries, user database.User, name string) (database.Tag, error) {
+	tag, err := db.GetTagByName(ctx, database.GetTagByNameParams{UserID: user.ID, Name: name})
+	if errors.Is(err, sql.ErrNoRows) {
+		return db.CreateTag(ctx, database.CreateTagParams{
+			ID:        uuid.New(),
+			CreatedAt: time.Now(),
+			UpdatedAt: time.Now(),
+			UserID:    user.ID,
+			Name:      name,
+		})
+	}
+	return tag, err
+}
+
+// tagFollow puts a feed the user follows under a tag.
+func tagFollow(ctx context.Context, db *database.Queries, user database.User, feedID uuid.UUID, name string) error {
+	tag, err := ensureTag(ctx, db, user, name)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.TagFeedFollow(ctx, database.TagFeedFollowParams{
+		TagID:  tag.ID,
+		UserID: user.ID,
+		FeedID: feedID,
+	})
+	return err
+}
+
+// followTags maps each followed feed of the user to the names of its tags.
+func followTags(ctx context.Context, db *database.Queries, user database.User) (map[uuid.UUID][]string, error) {
+	rows, err := db.GetFeedFollowTagsForUser(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := map[uuid.UUID][]string{}
+	for _, row := range rows {
+		tags[row.FeedID] = append(tags[row.FeedID], row.Name)
+	}
+	return tags, nil
+}
+
+func handlerTagList(s *state, user database.User) error {
+	tags, err := s.db.GetTagsForUser(context.Background(), user.ID)
+	if err != nil {
+		return err
+	}
+
+	if len(tags) == 0 {
+		fmt.Println("No tags")
+		return nil
+	}
+
+	for _, tag := range tags {
+		fmt.Printf("%s (%d feeds)\n", tag.Name, tag.FeedCount)
+	}
+
+	return nil
+}
+
+func handlerTagCreate(s *state, args []string, user database.User) error {
+	if len(args) < 1 {
+		return errors.New("not enough arguments. needs name")
+	}
+
+	tag, err := s.db.CreateTag(context.Background(), database.CreateTagParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		UserID:    user.ID,
+		Name:      args[0],
+	})
+	if isUniqueViolation(err) {
+		return fmt.Errorf("tag %s already exists", args[0])
+	} else if err != nil {
+		return err
+	}
+
+	fmt.Printf("Created tag %s\n", tag.Name)
+
+	return nil
+}
+
+func handlerTagRename(s *state, args []string, user database.User) error {
+	if len(args) < 2 {
+		return errors.New("not enough arguments. needs name and new name")
+	}
+
+	renamed, err := s.db.RenameTag(context.Background(), database.RenameTagParams{
+		NewName: args[1],
+		UserID:  user.ID,
+		Name:    args[0],
+	})
+	if isUniqueViolation(err) {
+		return fmt.Errorf("tag %s already exists", args[1])
+	} else if err != nil {
+		return err
+	}
+	if renamed == 0 {
+		return fmt.Errorf("no tag %s", args[0])
+	}
+
+	fmt.Printf("Renamed tag %s to %s\n", args[0], args[1])
+
+	return nil
+}
+
+func handlerTagDelete(s *state, args []string, user database.User) error {
+	if len(args) < 1 {
+		return errors.New("not enough arguments. needs name")
+	}
+
+	deleted, err := s.db.DeleteTag(context.Background(), database.DeleteTagParams{
+		UserID: user.ID,
+		Name:   args[0],
+	})
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return fmt.Errorf("no tag %s", args[0])
+	}
+
+	fmt.Printf("Deleted tag %s. Its feeds are still followed\n", args[0])
+
+	return nil
+}
+
+func handlerTagAdd(s *state, args []string, user database.User) error {
+	if len(args) < 2 {
+		return errors.New("not enough arguments. needs tag and feed url")
+	}
+
+	feed, err := s.db.GetFeedByUrl(context.Background(), args[1])
+	if err != nil {
+		return err
+	}
+
+	tag, err := ensureTag(context.Background(), s.db, user, args[0])
+	if err != nil {
+		return err
+	}
+
+	tagged, err := s.db.TagFeedFollow(context.Background(), database.TagFeedFollowParams{
+		TagID:  tag.ID,
+		UserID: user.ID,
+		FeedID: feed.ID,
+	})
+	if err != nil {
+		return err
+	}
+	if tagged == 0 {
+		// Either the feed is not followed or it already has the tag.
+		fmt.Printf("%s was not tagged %s. Is it followed?\n", feed.Name, tag.Name)
+		return nil
+	}
+
+	fmt.Printf("Tagged %s as %s\n", feed.Name, tag.Name)
+
+	return nil
+}
+
+func handlerTagRemove(s *state, args []string, user database.User) error {
+	if len(args) < 2 {
+		return errors.New("not enough arguments. needs tag and feed url")
+	}
+
+	feed, err := s.db.GetFeedByUrl(context.Background(), args[1])
+	if err != nil {
+		return err
+	}
+
+	tag, err := s.db.GetTagByName(context.Background(), database.GetTagByNameParams{UserID: user.ID, Name: args[0]})
+	if err != nil {
+		return err
+	}
+
+	removed, err := s.db.UntagFeedFollow(context.Background(), database.UntagFeedFollowParams{
+		UserID: user.ID,
+		FeedID: feed.ID,
+		TagID:  tag.ID,
+	})
+	if err != nil {
+		return err
+	}
+	if removed == 0 {
+		return fmt.Errorf("%s is not tagged %s", feed.Name, tag.Name)
+	}
+
+	fmt.Printf("Removed tag %s from %s\n", tag.Name, feed.Name)
+
+	return nil
+}
+
+func handlerTag(s *state, cmd command, user database.User) error {
+	if len(cmd.args) < 1 {
+		return errors.New("usage: tag list|create|rename|delete|add|remove")
+	}
+
+	switch cmd.args[0] {
+	case "list":
+		return handlerTagList(s, user)
+	case "create":
+		return handlerTagCreate(s, cmd.args[1:], user)
+	case "rename":
+		return handlerTagRename(s, cmd.args[1:], user)
+	case "delete":
+		return handlerTagDelete(s, cmd.args[1:], user)
+	case "add":
+		return handlerTagAdd(s, cmd.args[1:], user)
+	case "remove":
+		return handlerTagRemove(s, cmd.args[1:], user)
+	}
+
+	return fmt.Errorf("unknown tag command %q. use list, create, rename, delete, add or remove", cmd.args[0])
+}
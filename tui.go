@@ -0,0 +1,604 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alpsilva/go-blog-aggregator.git/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	tuiPostsLimit = 200
+
+	ansiAltScreen     = "\x1b[?1049h"
+	ansiMainScreen    = "\x1b[?1049l"
+	ansiHideCursor    = "\x1b[?25l"
+	ansiShowCursor    = "\x1b[?25h"
+	ansiClear         = "\x1b[H\x1b[2J"
+	ansiReverse       = "\x1b[7m"
+	ansiBold          = "\x1b[1m"
+	ansiDim           = "\x1b[2m"
+	ansiReset         = "\x1b[0m"
+	tuiPaneSeparator  = " │ "
+	tuiHelp           = "tab/←→ pane  ↑↓/jk move  enter read  m mark read  s star  o open  r refresh  f follow/unfollow  q quit"
+	tuiAllFeedsLabel  = "All feeds"
+	tuiNotFollowedMsg = "Not followed. Press f to follow this feed."
+)
+
+type tuiPane int
+
+const (
+	paneFeeds tuiPane = iota
+	panePosts
+	paneReader
+)
+
+// fitText cuts or pads text to exactly width runes.
+func fitText(text string, width int) string {
+	runes := []rune(text)
+	if len(runes) > width {
+		if width > 1 {
+			return string(runes[:width-1]) + "…"
+		}
+		return string(runes[:width])
+	}
+	return text + strings.Repeat(" ", width-len(runes))
+}
+
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	output, err := cmd.Output()
+	return strings.TrimSpace(string(output)), err
+}
+
+func terminalSize() (int, int, error) {
+	size, err := stty("size")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	rows, cols, ok := strings.Cut(size, " ")
+	if !ok {
+		return 0, 0, fmt.Errorf("unexpected terminal size %q", size)
+	}
+
+	height, err := strconv.Atoi(rows)
+	if err != nil {
+		return 0, 0, err
+	}
+	width, err := strconv.Atoi(cols)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return width, height, nil
+}
+
+func readKey() (string, error) {
+	buf := make([]byte, 16)
+	n, err := os.Stdin.Read(buf)
+	if err != nil {
+		return "", err
+	}
+
+	switch key := string(buf[:n]); key {
+	case "\x1b[A":
+		return "up", nil
+	case "\x1b[B":
+		return "down", nil
+	case "\x1b[C":
+		return "right", nil
+	case "\x1b[D":
+		return "left", nil
+	case "\r", "\n":
+		return "enter", nil
+	case "\t":
+		return "tab", nil
+	case "\x03":
+		return "ctrl-c", nil
+	default:
+		return key, nil
+	}
+}
+
+func openBrowser(target string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", target)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", target)
+	default:
+		cmd = exec.Command("xdg-open", target)
+	}
+	return cmd.Start()
+}
+
+type tui struct {
+	s    *state
+	user database.User
+
+	feeds    []database.Feed
+	followed map[uuid.UUID]int64
+	posts    []database.GetTimelineForUserRow
+
+	focus        tuiPane
+	feedIndex    int
+	postIndex    int
+	readerScroll int
+	reading      bool
+	status       string
+
+	// width and height are the terminal size, read again on resized.
+	width   int
+	height  int
+	resized chan os.Signal
+}
+
+// selectedFeed is the feed under the cursor, or false for "All feeds".
+func (t *tui) selectedFeed() (database.Feed, bool) {
+	if t.feedIndex == 0 {
+		return database.Feed{}, false
+	}
+	return t.feeds[t.feedIndex-1], true
+}
+
+func (t *tui) selectedPost() (database.GetTimelineForUserRow, bool) {
+	if t.postIndex >= len(t.posts) {
+		return database.GetTimelineForUserRow{}, false
+	}
+	return t.posts[t.postIndex], true
+}
+
+func (t *tui) loadFeeds() error {
+	feeds, err := t.s.db.GetFeeds(context.Background())
+	if err != nil {
+		return err
+	}
+
+	follows, err := t.s.db.GetFeedFollowsForUser(context.Background(), t.user.ID)
+	if err != nil {
+		return err
+	}
+
+	t.feeds = feeds
+	t.followed = map[uuid.UUID]int64{}
+	for _, follow := range follows {
+		t.followed[follow.ID] = follow.UnreadCount
+	}
+	t.feedIndex = min(t.feedIndex, len(t.feeds))
+
+	return nil
+}
+
+func (t *tui) loadPosts() error {
+	params := database.GetTimelineForUserParams{
+		UserID:   t.user.ID,
+		MaxPosts: tuiPostsLimit,
+	}
+	if feed, ok := t.selectedFeed(); ok {
+		params.FeedUrl = sql.NullString{String: feed.Url, Valid: true}
+	}
+
+	posts, err := t.s.db.GetTimelineForUser(context.Background(), params)
+	if err != nil {
+		return err
+	}
+
+	t.posts = posts
+	t.postIndex = min(t.postIndex, max(len(t.posts)-1, 0))
+	t.readerScroll = 0
+
+	return nil
+}
+
+func (t *tui) reload() error {
+	err := t.loadFeeds()
+	if err != nil {
+		return err
+	}
+	return t.loadPosts()
+}
+
+func (t *tui) feedLines() []string {
+	lines := []string{tuiAllFeedsLabel}
+	for _, feed := range t.feeds {
+		unread, ok := t.followed[feed.ID]
+		switch {
+		case !ok:
+			lines = append(lines, "  "+feed.Name)
+		case unread > 0:
+			lines = append(lines, fmt.Sprintf("● %s (%d)", feed.Name, unread))
+		default:
+			lines = append(lines, "● "+feed.Name)
+		}
+	}
+	return lines
+}
+
+func (t *tui) postLines() []string {
+	if feed, ok := t.selectedFeed(); ok {
+		if _, followed := t.followed[feed.ID]; !followed {
+			return []string{tuiNotFollowedMsg}
+		}
+	}
+
+	lines := []string{}
+	for _, post := range t.posts {
+		marker := " "
+		if !post.ReadAt.Valid {
+			marker = "•"
+		}
+		if post.StarredAt.Valid {
+			marker = "★"
+		}
+		lines = append(lines, fmt.Sprintf("%s %s %s", marker, post.PublishedAt.Format("Jan 02"), post.Title))
+	}
+	if len(lines) == 0 {
+		lines = append(lines, "No posts")
+	}
+	return lines
+}
+
+func (t *tui) readerLines(width int) []string {
+	post, ok := t.selectedPost()
+	if !ok || !t.reading {
+		return []string{"Press enter on a post to read it."}
+	}
+
+	lines := wrapText(post.Title, width)
+	lines = append(lines, fmt.Sprintf("%s · %s", post.FeedName, post.PublishedAt.Format(time.DateTime)))
+	lines = append(lines, post.Url, "")
+	lines = append(lines, renderHTML(postContent(post.Content, post.Description), post.Url, width, false)...)
+	return lines
+}
+
+// paneRows returns height rows of lines starting so that the cursor stays
+// visible, with the cursor row highlighted when the pane is focused.
+func paneRows(lines []string, cursor int, width int, height int, focused bool) []string {
+	start := 0
+	if cursor >= height {
+		start = cursor - height + 1
+	}
+
+	rows := []string{}
+	for i := start; i < start+height; i++ {
+		text := ""
+		if i < len(lines) {
+			text = lines[i]
+		}
+		row := fitText(text, width)
+		if i == cursor && cursor >= 0 {
+			if focused {
+				row = ansiReverse + row + ansiReset
+			} else {
+				row = ansiBold + row + ansiReset
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// updateSize reads the terminal size again when it was resized since the
+// last call. Running stty on every frame is too slow.
+func (t *tui) updateSize() error {
+	select {
+	case <-t.resized:
+	default:
+		if t.width > 0 {
+			return nil
+		}
+	}
+
+	width, height, err := terminalSize()
+	if err != nil {
+		return err
+	}
+	t.width, t.height = width, height
+
+	return nil
+}
+
+func (t *tui) draw() error {
+	err := t.updateSize()
+	if err != nil {
+		return err
+	}
+	width, height := t.width, t.height
+
+	bodyHeight := max(height-2, 1)
+	separator := len([]rune(tuiPaneSeparator))
+	feedsWidth := max(width/5, 10)
+	postsWidth := max(width*3/10, 20)
+	readerWidth := max(width-feedsWidth-postsWidth-2*separator, 10)
+
+	feeds := paneRows(t.feedLines(), t.feedIndex, feedsWidth, bodyHeight, t.focus == paneFeeds)
+
+	postCursor := t.postIndex
+	if len(t.posts) == 0 {
+		postCursor = -1
+	}
+	posts := paneRows(t.postLines(), postCursor, postsWidth, bodyHeight, t.focus == panePosts)
+
+	readerLines := t.readerLines(readerWidth)
+	t.readerScroll = min(t.readerScroll, max(len(readerLines)-bodyHeight, 0))
+	reader := paneRows(readerLines[t.readerScroll:], -1, readerWidth, bodyHeight, false)
+
+	frame := strings.Builder{}
+	frame.WriteString(ansiClear)
+	frame.WriteString(ansiReverse + fitText(fmt.Sprintf(" gator - %s", t.user.Name), width) + ansiReset + "\r\n")
+	for i := range bodyHeight {
+		frame.WriteString(feeds[i] + tuiPaneSeparator + posts[i] + tuiPaneSeparator + reader[i] + "\r\n")
+	}
+
+	footer := tuiHelp
+	if t.status != "" {
+		footer = t.status
+	}
+	frame.WriteString(ansiDim + fitText(footer, width) + ansiReset)
+
+	_, err = os.Stdout.WriteString(frame.String())
+	return err
+}
+
+func (t *tui) move(delta int) error {
+	switch t.focus {
+	case paneFeeds:
+		next := min(max(t.feedIndex+delta, 0), len(t.feeds))
+		if next == t.feedIndex {
+			return nil
+		}
+		t.feedIndex = next
+		t.postIndex = 0
+		t.reading = false
+		return t.loadPosts()
+	case panePosts:
+		t.postIndex = min(max(t.postIndex+delta, 0), max(len(t.posts)-1, 0))
+		t.readerScroll = 0
+		t.reading = false
+	case paneReader:
+		t.readerScroll = max(t.readerScroll+delta, 0)
+	}
+	return nil
+}
+
+func (t *tui) markRead() error {
+	post, ok := t.selectedPost()
+	if !ok {
+		return nil
+	}
+
+	err := t.s.db.MarkPostRead(context.Background(), database.MarkPostReadParams{
+		UserID: t.user.ID,
+		PostID: post.ID,
+	})
+	if err != nil {
+		return err
+	}
+
+	t.posts[t.postIndex].ReadAt = sql.NullTime{Time: time.Now(), Valid: true}
+	if !post.ReadAt.Valid && t.followed[post.FeedID] > 0 {
+		t.followed[post.FeedID]--
+	}
+
+	return nil
+}
+
+func (t *tui) toggleStar() error {
+	post, ok := t.selectedPost()
+	if !ok {
+		return nil
+	}
+
+	params := database.StarPostParams{UserID: t.user.ID, PostID: post.ID}
+	if post.StarredAt.Valid {
+		err := t.s.db.UnstarPost(context.Background(), database.UnstarPostParams(params))
+		if err != nil {
+			return err
+		}
+		t.posts[t.postIndex].StarredAt = sql.NullTime{}
+		t.status = "Unstarred " + post.Title
+		return nil
+	}
+
+	err := t.s.db.StarPost(context.Background(), params)
+	if err != nil {
+		return err
+	}
+	t.posts[t.postIndex].StarredAt = sql.NullTime{Time: time.Now(), Valid: true}
+	t.status = "Starred " + post.Title
+
+	return nil
+}
+
+// refresh fetches the selected feed, or every followed feed, right away.
+func (t *tui) refresh() error {
+	feeds := []database.Feed{}
+	if feed, ok := t.selectedFeed(); ok {
+		feeds = append(feeds, feed)
+	} else {
+		for _, feed := range t.feeds {
+			if _, followed := t.followed[feed.ID]; followed {
+				feeds = append(feeds, feed)
+			}
+		}
+	}
+
+	t.status = fmt.Sprintf("Refreshing %d feeds...", len(feeds))
+	err := t.draw()
+	if err != nil {
+		return err
+	}
+
+	// Like agg, only fetch feeds nobody else is fetching, and hold their
+	// lease until done. Their schedule doesn't matter here.
+	claimed := []database.Feed{}
+	leaseUntil := time.Now().Add(time.Duration(len(feeds)) * feedTimeout)
+	for _, feed := range feeds {
+		claimedFeed, err := t.s.db.ClaimFeed(context.Background(), database.ClaimFeedParams{
+			LeaseUntil: leaseUntil,
+			ID:         feed.ID,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		claimed = append(claimed, claimedFeed)
+	}
+
+	// Progress messages would garble the screen, errors end up in the status.
+	err = fetchClaimedFeeds(t.s, io.Discard, claimed, 1)
+
+	t.status = fmt.Sprintf("Refreshed %d feeds", len(claimed))
+	if skipped := len(feeds) - len(claimed); skipped > 0 {
+		t.status += fmt.Sprintf(", %d disabled or already being fetched", skipped)
+	}
+	if err != nil {
+		t.status = err.Error()
+	}
+
+	return t.reload()
+}
+
+func (t *tui) toggleFollow() error {
+	feed, ok := t.selectedFeed()
+	if !ok {
+		return nil
+	}
+
+	if _, followed := t.followed[feed.ID]; followed {
+		err := t.s.db.DeleteFeedFollow(context.Background(), database.DeleteFeedFollowParams{
+			UserID: t.user.ID,
+			FeedID: feed.ID,
+		})
+		if err != nil {
+			return err
+		}
+		t.status = "Unfollowed " + feed.Name
+	} else {
+		_, err := followFeed(context.Background(), t.s.db, t.user, feed.ID)
+		if err != nil {
+			return err
+		}
+		t.status = "Following " + feed.Name
+	}
+
+	return t.reload()
+}
+
+// handleKey applies a key press and reports whether the tui should exit.
+func (t *tui) handleKey(key string) (bool, error) {
+	t.status = ""
+
+	switch key {
+	case "q", "ctrl-c":
+		return true, nil
+	case "up", "k":
+		return false, t.move(-1)
+	case "down", "j":
+		return false, t.move(1)
+	case "tab":
+		t.focus = (t.focus + 1) % 3
+	case "left", "h":
+		t.focus = max(t.focus-1, paneFeeds)
+	case "right", "l":
+		t.focus = min(t.focus+1, paneReader)
+	case "enter":
+		if t.focus == paneFeeds {
+			t.focus = panePosts
+			return false, nil
+		}
+		if _, ok := t.selectedPost(); ok {
+			t.reading = true
+			t.readerScroll = 0
+			t.focus = paneReader
+			return false, t.markRead()
+		}
+	case "m":
+		return false, t.markRead()
+	case "s":
+		return false, t.toggleStar()
+	case "o":
+		post, ok := t.selectedPost()
+		if ok && post.Url != "" {
+			return false, openBrowser(post.Url)
+		}
+	case "r":
+		return false, t.refresh()
+	case "f":
+		return false, t.toggleFollow()
+	}
+
+	return false, nil
+}
+
+func (t *tui) run() error {
+	saved, err := stty("-g")
+	if err != nil {
+		return errors.New("tui needs an interactive terminal")
+	}
+
+	_, err = stty("raw", "-echo")
+	if err != nil {
+		return err
+	}
+	os.Stdout.WriteString(ansiAltScreen + ansiHideCursor)
+	defer func() {
+		os.Stdout.WriteString(ansiShowCursor + ansiMainScreen)
+		stty(saved)
+	}()
+
+	// Notify without signals would relay all of them.
+	t.resized = make(chan os.Signal, 1)
+	if len(resizeSignals) > 0 {
+		signal.Notify(t.resized, resizeSignals...)
+		defer signal.Stop(t.resized)
+	}
+
+	for {
+		err = t.draw()
+		if err != nil {
+			return err
+		}
+
+		key, err := readKey()
+		if err != nil {
+			return err
+		}
+
+		quit, err := t.handleKey(key)
+		if err != nil {
+			// Errors are shown rather than ending the session.
+			t.status = err.Error()
+		}
+		if quit {
+			return nil
+		}
+	}
+}
+
+func handlerTUI(s *state, cmd command, user database.User) error {
+	t := &tui{s: s, user: user}
+
+	err := t.reload()
+	if err != nil {
+		return err
+	}
+
+	return t.run()
+}
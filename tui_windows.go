@@ -0,0 +1,7 @@
+package main
+
+import "os"
+
+// resizeSignals is empty as Windows has no signal for terminal resizes, the
+// size read at startup is kept.
+var resizeSignals = []os.Signal{}
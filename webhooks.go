@@ -0,0 +1,367 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/alpsilva/go-blog-aggregator.git/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	webhookTimeout     = 10 * time.Second
+	webhookBatchSize   = 50
+	webhookMaxAttempts = 10
+	// webhookInterval is how often agg looks for deliveries that are due,
+	// independently of how often it collects feeds.
+	webhookInterval = 30 * time.Second
+	// webhookRetryBase is the wait after the first failed attempt. It
+	// doubles with every attempt up to webhookMaxRetryWait.
+	webhookRetryBase    = time.Minute
+	webhookMaxRetryWait = 12 * time.Hour
+	webhookSignature    = "X-Gator-Signature"
+)
+
+var webhookClient = &http.Client{Timeout: webhookTimeout}
+
+type webhookPost struct {
+	ID          uuid.UUID `json:"id"`
+	Title       string    `json:"title"`
+	Url         string    `json:"url"`
+	Description *string   `json:"description"`
+	PublishedAt time.Time `json:"published_at"`
+	GUID        string    `json:"guid"`
+}
+
+type webhookFeed struct {
+	ID   uuid.UUID `json:"id"`
+	Name string    `json:"name"`
+	Url  string    `json:"url"`
+}
+
+type webhookPayload struct {
+	Event      string      `json:"event"`
+	DeliveryID uuid.UUID   `json:"delivery_id"`
+	Post       webhookPost `json:"post"`
+	Feed       webhookFeed `json:"feed"`
+}
+
+func newWebhookPayload(delivery database.ClaimWebhookDeliveriesRow) webhookPayload {
+	return webhookPayload{
+		Event:      "post.created",
+		DeliveryID: delivery.ID,
+		Post: webhookPost{
+			ID:          delivery.PostID,
+			Title:       delivery.Title,
+			Url:         delivery.Url,
+			Description: nullStringPtr(delivery.Description),
+			PublishedAt: delivery.PublishedAt,
+			GUID:        delivery.Guid,
+		},
+		Feed: webhookFeed{
+			ID:   delivery.FeedID,
+			Name: delivery.FeedName,
+			Url:  delivery.FeedUrl,
+		},
+	}
+}
+
+// signWebhook returns the X-Gator-Signature header for body, formatted like
+// WebSub signatures as "sha256=hexdigest".
+func signWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookRetryWait is how long to wait before the next attempt once a
+// delivery has failed attempts times.
+func webhookRetryWait(attempts int32) time.Duration {
+	wait := webhookRetryBase
+	for range attempts - 1 {
+		wait *= 2
+		if wait >= webhookMaxRetryWait {
+			return webhookMaxRetryWait
+		}
+	}
+	return wait
+}
+
+// postWebhook sends one delivery and returns the status code of the
+// response, or zero if there was none.
+func postWebhook(ctx context.Context, delivery database.ClaimWebhookDeliveriesRow) (int, error) {
+	body, err := json.Marshal(newWebhookPayload(delivery))
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", delivery.WebhookUrl, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "gator")
+	req.Header.Set("X-Gator-Event", "post.created")
+	req.Header.Set("X-Gator-Delivery", delivery.ID.String())
+	req.Header.Set(webhookSignature, signWebhook(delivery.Secret, body))
+
+	response, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(response.Body, 64<<10))
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return response.StatusCode, fmt.Errorf("unexpected status: %s", response.Status)
+	}
+
+	return response.StatusCode, nil
+}
+
+// deliverWebhooks sends the webhook deliveries that are due, scheduling a
+// retry with exponential backoff for the ones that fail.
+func deliverWebhooks(ctx context.Context, db *database.Queries) error {
+	deliveries, err := db.ClaimWebhookDeliveries(ctx, database.ClaimWebhookDeliveriesParams{
+		// Nobody else picks the deliveries up while they are being sent.
+		LeaseUntil:    time.Now().Add(webhookBatchSize * webhookTimeout),
+		MaxAttempts:   webhookMaxAttempts,
+		MaxDeliveries: webhookBatchSize,
+	})
+	if err != nil {
+		return err
+	}
+
+	errs := []error{}
+	for _, delivery := range deliveries {
+		statusCode, postErr := postWebhook(ctx, delivery)
+		status := sql.NullInt32{Int32: int32(statusCode), Valid: statusCode != 0}
+
+		if postErr == nil {
+			err = db.MarkWebhookDelivered(ctx, database.MarkWebhookDeliveredParams{
+				ID:         delivery.ID,
+				StatusCode: status,
+			})
+			if err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+
+		attempts := delivery.Attempts + 1
+		if attempts >= webhookMaxAttempts {
+			fmt.Printf("giving up on webhook %s for '%s' after %d attempts: %s\n", delivery.WebhookUrl, delivery.Title, attempts, postErr)
+		} else {
+			fmt.Printf("error delivering webhook %s for '%s': %s\n", delivery.WebhookUrl, delivery.Title, postErr)
+		}
+
+		err = db.RecordWebhookFailure(ctx, database.RecordWebhookFailureParams{
+			ID:            delivery.ID,
+			StatusCode:    status,
+			LastError:     sql.NullString{String: postErr.Error(), Valid: true},
+			NextAttemptAt: time.Now().Add(webhookRetryWait(attempts)),
+		})
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// deliverWebhooksLoop delivers webhooks on its own ticker until ctx is
+// done, so slow endpoints don't hold up collecting feeds.
+func deliverWebhooksLoop(ctx context.Context, db *database.Queries) {
+	ticker := time.NewTicker(webhookInterval)
+	defer ticker.Stop()
+
+	for {
+		err := deliverWebhooks(ctx, db)
+		if err != nil && ctx.Err() == nil {
+			fmt.Println(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func handlerWebhookAdd(s *state, args []string, user database.User) error {
+	fs := flag.NewFlagSet("webhook add", flag.ContinueOnError)
+	feedURL := fs.String("feed", "", "only send posts of this feed")
+	keyword := fs.String("keyword", "", "only send posts whose title or description contains this word")
+	args, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+
+	if len(args) < 1 {
+		return errors.New("not enough arguments. needs url")
+	}
+
+	endpoint, err := url.Parse(args[0])
+	if err != nil {
+		return err
+	}
+	if endpoint.Scheme != "http" && endpoint.Scheme != "https" {
+		return errors.New("webhook url must be http or https")
+	}
+
+	params := database.CreateWebhookParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		UserID:    user.ID,
+		Keyword:   sql.NullString{String: *keyword, Valid: *keyword != ""},
+		Url:       endpoint.String(),
+	}
+
+	if *feedURL != "" {
+		feed, err := s.db.GetFeedByUrl(context.Background(), *feedURL)
+		if err != nil {
+			return err
+		}
+		params.FeedID = uuid.NullUUID{UUID: feed.ID, Valid: true}
+	}
+
+	secret := make([]byte, 32)
+	_, err = rand.Read(secret)
+	if err != nil {
+		return err
+	}
+	params.Secret = hex.EncodeToString(secret)
+
+	webhook, err := s.db.CreateWebhook(context.Background(), params)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Created webhook %s\n", webhook.ID)
+	fmt.Printf("Requests are signed with HMAC-SHA256 in the %s header using secret %s\n", webhookSignature, webhook.Secret)
+
+	return nil
+}
+
+func handlerWebhookList(s *state, user database.User) error {
+	webhooks, err := s.db.GetWebhooksForUser(context.Background(), user.ID)
+	if err != nil {
+		return err
+	}
+
+	if len(webhooks) == 0 {
+		fmt.Println("No webhooks")
+		return nil
+	}
+
+	for _, webhook := range webhooks {
+		fmt.Printf("%s - %s\n", webhook.ID, webhook.Url)
+		if webhook.FeedUrl.Valid {
+			fmt.Printf("  feed: %s\n", webhook.FeedUrl.String)
+		}
+		if webhook.Keyword.Valid {
+			fmt.Printf("  keyword: %s\n", webhook.Keyword.String)
+		}
+	}
+
+	return nil
+}
+
+func handlerWebhookDelete(s *state, args []string, user database.User) error {
+	if len(args) < 1 {
+		return errors.New("not enough arguments. needs webhook id")
+	}
+
+	id, err := uuid.Parse(args[0])
+	if err != nil {
+		return err
+	}
+
+	deleted, err := s.db.DeleteWebhook(context.Background(), database.DeleteWebhookParams{
+		ID:     id,
+		UserID: user.ID,
+	})
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return fmt.Errorf("no webhook %s", id)
+	}
+
+	fmt.Printf("Deleted webhook %s\n", id)
+
+	return nil
+}
+
+func handlerWebhookLog(s *state, args []string, user database.User) error {
+	limit := 20
+	if len(args) > 0 {
+		var err error
+		limit, err = strconv.Atoi(args[0])
+		if err != nil {
+			return err
+		}
+	}
+
+	deliveries, err := s.db.GetWebhookDeliveriesForUser(context.Background(), database.GetWebhookDeliveriesForUserParams{
+		UserID: user.ID,
+		Limit:  int32(limit),
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, delivery := range deliveries {
+		status := "pending"
+		switch {
+		case delivery.DeliveredAt.Valid:
+			status = "delivered " + delivery.DeliveredAt.Time.Format(time.DateTime)
+		case delivery.Attempts >= webhookMaxAttempts:
+			status = "failed"
+		case delivery.Attempts > 0:
+			status = "retrying at " + delivery.NextAttemptAt.Format(time.DateTime)
+		}
+
+		fmt.Printf("%s - %s -> %s: %s (%d attempts)\n", delivery.CreatedAt.Format(time.DateTime), delivery.PostTitle, delivery.WebhookUrl, status, delivery.Attempts)
+		if delivery.LastError.Valid && !delivery.DeliveredAt.Valid {
+			fmt.Printf("  last error: %s\n", delivery.LastError.String)
+		}
+	}
+
+	return nil
+}
+
+func handlerWebhook(s *state, cmd command, user database.User) error {
+	if len(cmd.args) < 1 {
+		return errors.New("usage: webhook add|list|delete|log")
+	}
+
+	switch cmd.args[0] {
+	case "add":
+		return handlerWebhookAdd(s, cmd.args[1:], user)
+	case "list":
+		return handlerWebhookList(s, user)
+	case "delete":
+		return handlerWebhookDelete(s, cmd.args[1:], user)
+	case "log":
+		return handlerWebhookLog(s, cmd.args[1:], user)
+	}
+
+	return fmt.Errorf("unknown webhook command %q. use add, list, delete or log", cmd.args[0])
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDeliverWebhooksLoopStops(t *testing.T) {
+	fake, db := newFakeDB(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		deliverWebhooksLoop(ctx, db)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(fake.called("ClaimWebhookDeliveries")) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("deliveries were never claimed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("loop kept running after shutdown")
+	}
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alpsilva/go-blog-aggregator.git/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	webSubLeaseSeconds  = 10 * 24 * 60 * 60
+	webSubRenewInterval = 10 * time.Minute
+	// webSubRenewMargin is how long before a lease expires it gets renewed.
+	webSubRenewMargin = 24 * time.Hour
+	// webSubRetryAfter is how long to wait for a hub that never verified a
+	// subscription before asking again.
+	webSubRetryAfter   = time.Hour
+	maxWebSubBodyBytes = 10 << 20
+)
+
+var webSubSignatureHashes = map[string]func() hash.Hash{
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha384": sha512.New384,
+	"sha512": sha512.New,
+}
+
+// hubLinks returns the WebSub hub and self URLs a feed advertises through
+// <link rel="hub"> and <link rel="self">.
+func (f *RSSFeed) hubLinks() (string, string) {
+	hub, self := "", ""
+	for _, link := range f.Channel.AtomLinks {
+		switch link.Rel {
+		case "hub":
+			if hub == "" {
+				hub = link.Href
+			}
+		case "self":
+			if self == "" {
+				self = link.Href
+			}
+		}
+	}
+	return hub, self
+}
+
+// recordWebSubHub remembers the hub of a feed so that serve mode can
+// subscribe to it. When the feed moves to another hub or topic, the lease
+// of the old subscription no longer applies and serve subscribes again.
+func recordWebSubHub(ctx context.Context, db *database.Queries, feed database.Feed, rssFeed *RSSFeed) error {
+	hub, self := rssFeed.hubLinks()
+	if hub == "" {
+		return nil
+	}
+	if self == "" {
+		self = feed.Url
+	}
+
+	existing, err := db.GetWebSubSubscriptionByFeed(ctx, feed.ID)
+	if err == nil && existing.HubUrl == hub && existing.TopicUrl == self {
+		return nil
+	}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	secret := make([]byte, 32)
+	_, err = rand.Read(secret)
+	if err != nil {
+		return err
+	}
+
+	return db.UpsertWebSubHub(ctx, database.UpsertWebSubHubParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		FeedID:    feed.ID,
+		HubUrl:    hub,
+		TopicUrl:  self,
+		Secret:    hex.EncodeToString(secret),
+	})
+}
+
+type webSubSubscriber struct {
+	db           *database.Queries
+	callbackBase string
+	client       *http.Client
+}
+
+func (w *webSubSubscriber) callbackURL(sub database.WebsubSubscription) string {
+	return strings.TrimSuffix(w.callbackBase, "/") + "/websub/" + sub.ID.String()
+}
+
+func (w *webSubSubscriber) subscribe(ctx context.Context, sub database.WebsubSubscription) error {
+	form := url.Values{}
+	form.Set("hub.mode", "subscribe")
+	form.Set("hub.topic", sub.TopicUrl)
+	form.Set("hub.callback", w.callbackURL(sub))
+	form.Set("hub.secret", sub.Secret)
+	form.Set("hub.lease_seconds", strconv.Itoa(webSubLeaseSeconds))
+
+	req, err := http.NewRequestWithContext(ctx, "POST", sub.HubUrl, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", "gator")
+
+	response, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusAccepted && response.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("hub %s refused subscription to %s: %s", sub.HubUrl, sub.TopicUrl, response.Status)
+	}
+
+	return w.db.MarkWebSubRequested(ctx, sub.ID)
+}
+
+// renew subscribes to every hub without a lease or whose lease is about to
+// expire. The hub confirms asynchronously through handlerVerify.
+func (w *webSubSubscriber) renew(ctx context.Context) error {
+	now := time.Now()
+	subs, err := w.db.GetWebSubSubscriptionsToRenew(ctx, database.GetWebSubSubscriptionsToRenewParams{
+		RenewBefore: now.Add(webSubRenewMargin),
+		RetryBefore: now.Add(-webSubRetryAfter),
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, sub := range subs {
+		err = w.subscribe(ctx, sub)
+		if err != nil {
+			fmt.Println(err)
+		}
+	}
+
+	return nil
+}
+
+func (w *webSubSubscriber) renewLoop(ctx context.Context) {
+	ticker := time.NewTicker(webSubRenewInterval)
+	defer ticker.Stop()
+
+	for ; ; <-ticker.C {
+		err := w.renew(ctx)
+		if err != nil {
+			fmt.Println(err)
+		}
+	}
+}
+
+func (w *webSubSubscriber) subscription(r *http.Request) (database.WebsubSubscription, error) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		return database.WebsubSubscription{}, sql.ErrNoRows
+	}
+
+	return w.db.GetWebSubSubscription(r.Context(), id)
+}
+
+// handlerVerify answers the hub's verification of intent.
+func (w *webSubSubscriber) handlerVerify(rw http.ResponseWriter, r *http.Request) {
+	sub, err := w.subscription(r)
+	if err != nil {
+		respondWithDBError(rw, err)
+		return
+	}
+
+	query := r.URL.Query()
+	if query.Get("hub.topic") != sub.TopicUrl {
+		respondWithError(rw, http.StatusNotFound, "unknown topic")
+		return
+	}
+
+	switch query.Get("hub.mode") {
+	case "subscribe":
+		leaseSeconds, err := strconv.Atoi(query.Get("hub.lease_seconds"))
+		if err != nil {
+			leaseSeconds = webSubLeaseSeconds
+		}
+
+		err = w.db.ConfirmWebSubSubscription(r.Context(), database.ConfirmWebSubSubscriptionParams{
+			ID:             sub.ID,
+			LeaseExpiresAt: sql.NullTime{Time: time.Now().Add(time.Duration(leaseSeconds) * time.Second), Valid: true},
+		})
+		if err != nil {
+			respondWithError(rw, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		rw.Write([]byte(query.Get("hub.challenge")))
+	case "denied":
+		fmt.Printf("hub %s denied subscription to %s: %s\n", sub.HubUrl, sub.TopicUrl, query.Get("hub.reason"))
+		rw.WriteHeader(http.StatusOK)
+	default:
+		// gator never unsubscribes, so anything else was not asked for.
+		respondWithError(rw, http.StatusNotFound, "unexpected mode")
+	}
+}
+
+// validWebSubSignature checks the X-Hub-Signature header, formatted as
+// "method=hexdigest", against the HMAC of body.
+func validWebSubSignature(header string, secret string, body []byte) bool {
+	method, signature, ok := strings.Cut(header, "=")
+	if !ok {
+		return false
+	}
+
+	newHash, ok := webSubSignatureHashes[method]
+	if !ok {
+		return false
+	}
+
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(newHash, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+// handlerContent ingests the feed document a hub pushes.
+func (w *webSubSubscriber) handlerContent(rw http.ResponseWriter, r *http.Request) {
+	sub, err := w.subscription(r)
+	if err != nil {
+		respondWithDBError(rw, err)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebSubBodyBytes))
+	if err != nil {
+		respondWithError(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// The spec asks subscribers to acknowledge messages with a bad
+	// signature and drop them, so a forged request learns nothing from the
+	// response.
+	if !validWebSubSignature(r.Header.Get("X-Hub-Signature"), sub.Secret, body) {
+		fmt.Printf("ignoring websub content with invalid signature for %s\n", sub.TopicUrl)
+		rw.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	rssFeed, err := parseFeed(r.Header.Get("Content-Type"), body)
+	if err != nil {
+		respondWithError(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	feed, err := w.db.GetFeedById(r.Context(), sub.FeedID)
+	if err != nil {
+		respondWithDBError(rw, err)
+		return
+	}
+
+	_, err = savePosts(r.Context(), w.db, os.Stdout, feed, rssFeed)
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	rw.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alpsilva/go-blog-aggregator.git/internal/database"
+	"github.com/google/uuid"
+)
+
+const webSubTestDocument = `<?xml version="1.0"?>
+<rss version="2.0">
+<channel>
+<title>Pushed</title>
+<item>
+<title>Hello from the hub</title>
+<link>https://example.com/hello</link>
+<guid>https://example.com/hello</guid>
+</item>
+</channel>
+</rss>`
+
+func TestWebSubSubscribeVerifyAndPush(t *testing.T) {
+	fake, db := newFakeDB(t)
+
+	feed := database.Feed{ID: uuid.New(), Url: "https://example.com/feed.xml"}
+	sub := database.WebsubSubscription{
+		ID:       uuid.New(),
+		FeedID:   feed.ID,
+		TopicUrl: feed.Url,
+		Secret:   "hub-secret",
+	}
+
+	fake.answer("GetWebSubSubscription", func(args []driver.Value) []any {
+		if args[0] != sub.ID.String() {
+			return nil
+		}
+		return []any{sub}
+	})
+	fake.answer("GetFeedById", func(args []driver.Value) []any {
+		return []any{feed}
+	})
+	fake.answer("UpsertPost", func(args []driver.Value) []any {
+		return []any{database.UpsertPostRow{ID: uuid.New(), Url: args[4].(string), Inserted: true}}
+	})
+
+	// The hub acknowledges the subscription, then verifies intent on the
+	// callback the way the spec describes.
+	verified := make(chan string, 1)
+	hub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			t.Errorf("hub couldn't parse subscription: %v", err)
+		}
+		if r.Form.Get("hub.mode") != "subscribe" || r.Form.Get("hub.topic") != sub.TopicUrl || r.Form.Get("hub.secret") != sub.Secret {
+			t.Errorf("unexpected subscription request: %v", r.Form)
+		}
+		w.WriteHeader(http.StatusAccepted)
+
+		callback := r.Form.Get("hub.callback")
+		go func() {
+			query := url.Values{}
+			query.Set("hub.mode", "subscribe")
+			query.Set("hub.topic", sub.TopicUrl)
+			query.Set("hub.challenge", "challenge-123")
+			query.Set("hub.lease_seconds", "3600")
+
+			response, err := http.Get(callback + "?" + query.Encode())
+			if err != nil {
+				t.Errorf("hub couldn't verify intent: %v", err)
+				verified <- ""
+				return
+			}
+			defer response.Body.Close()
+
+			body, _ := io.ReadAll(response.Body)
+			verified <- string(body)
+		}()
+	}))
+	defer hub.Close()
+	sub.HubUrl = hub.URL
+
+	subscriber := &webSubSubscriber{db: db, client: hub.Client()}
+	api := apiServer{db: db, webSub: subscriber}
+	server := httptest.NewServer(api.routes())
+	defer server.Close()
+	subscriber.callbackBase = server.URL
+
+	err := subscriber.subscribe(context.Background(), sub)
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	if len(fake.called("MarkWebSubRequested")) != 1 {
+		t.Fatalf("subscription was not marked as requested")
+	}
+
+	select {
+	case challenge := <-verified:
+		if challenge != "challenge-123" {
+			t.Fatalf("callback answered the challenge with %q", challenge)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("hub never verified the subscription")
+	}
+	if len(fake.called("ConfirmWebSubSubscription")) != 1 {
+		t.Fatalf("verified subscription was not confirmed")
+	}
+
+	push := func(signature string) {
+		t.Helper()
+
+		req, err := http.NewRequest("POST", subscriber.callbackURL(sub), strings.NewReader(webSubTestDocument))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/rss+xml")
+		req.Header.Set("X-Hub-Signature", signature)
+
+		response, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+
+		if response.StatusCode != http.StatusAccepted {
+			t.Fatalf("push answered with %s", response.Status)
+		}
+	}
+
+	push("sha256=" + strings.Repeat("0", 64))
+	if len(fake.called("UpsertPost")) != 0 {
+		t.Fatalf("content with a bad signature was saved")
+	}
+
+	mac := hmac.New(sha256.New, []byte(sub.Secret))
+	mac.Write([]byte(webSubTestDocument))
+	push("sha256=" + hex.EncodeToString(mac.Sum(nil)))
+
+	upserts := fake.called("UpsertPost")
+	if len(upserts) != 1 {
+		t.Fatalf("expected 1 saved post, got %d", len(upserts))
+	}
+	if upserts[0][4] != "https://example.com/hello" {
+		t.Fatalf("saved post has url %v", upserts[0][4])
+	}
+}
+
+func TestValidWebSubSignature(t *testing.T) {
+	body := []byte("payload")
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write(body)
+	signature := hex.EncodeToString(mac.Sum(nil))
+
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{"sha256=" + signature, true},
+		{"sha1=" + signature, false},
+		{"md5=" + signature, false},
+		{signature, false},
+		{"sha256=not-hex", false},
+		{"", false},
+	}
+
+	for _, test := range tests {
+		got := validWebSubSignature(test.header, "secret", body)
+		if got != test.want {
+			t.Errorf("validWebSubSignature(%q) = %v, want %v", test.header, got, test.want)
+		}
+	}
+}
+
+func TestRecordWebSubHubResubscribesOnChange(t *testing.T) {
+	fake, db := newFakeDB(t)
+
+	feed := database.Feed{ID: uuid.New(), Url: "https://example.com/feed.xml"}
+	stored := []database.WebsubSubscription{}
+	fake.answer("GetWebSubSubscriptionByFeed", func(args []driver.Value) []any {
+		if len(stored) == 0 {
+			return nil
+		}
+		return []any{stored[0]}
+	})
+	fake.answer("UpsertWebSubHub", func(args []driver.Value) []any {
+		// Like the query, a new hub or topic starts without a lease.
+		stored = []database.WebsubSubscription{{
+			FeedID:   feed.ID,
+			HubUrl:   args[4].(string),
+			TopicUrl: args[5].(string),
+			Secret:   args[6].(string),
+		}}
+		return nil
+	})
+
+	record := func(hub string, self string) {
+		t.Helper()
+
+		rssFeed := &RSSFeed{}
+		rssFeed.Channel.AtomLinks = []AtomLink{{Rel: "hub", Href: hub}, {Rel: "self", Href: self}}
+		err := recordWebSubHub(context.Background(), db, feed, rssFeed)
+		if err != nil {
+			t.Fatalf("recordWebSubHub: %v", err)
+		}
+	}
+
+	record("https://hub.example.com/", feed.Url)
+	if len(fake.called("UpsertWebSubHub")) != 1 {
+		t.Fatal("new hub was not recorded")
+	}
+	stored[0].LeaseExpiresAt = sql.NullTime{Time: time.Now().Add(time.Hour), Valid: true}
+
+	record("https://hub.example.com/", feed.Url)
+	if len(fake.called("UpsertWebSubHub")) != 1 || !stored[0].LeaseExpiresAt.Valid {
+		t.Fatal("an unchanged hub dropped its lease")
+	}
+
+	record("https://other-hub.example.com/", feed.Url)
+	if len(fake.called("UpsertWebSubHub")) != 2 || stored[0].LeaseExpiresAt.Valid {
+		t.Fatal("moving to another hub kept the old lease")
+	}
+	stored[0].LeaseExpiresAt = sql.NullTime{Time: time.Now().Add(time.Hour), Valid: true}
+
+	record("https://other-hub.example.com/", "https://example.com/new-feed.xml")
+	if len(fake.called("UpsertWebSubHub")) != 3 || stored[0].TopicUrl != "https://example.com/new-feed.xml" {
+		t.Fatal("a new topic was not recorded")
+	}
+}